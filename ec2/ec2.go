@@ -0,0 +1,267 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package ec2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+)
+
+const (
+	// environment variables
+	enrichEnv    = "LP4K_ENRICH_INSTANCE"
+	ec2RegionEnv = "LP4K_EC2_REGION"
+	// context timeouts
+	configTimeout   = 5 * time.Second
+	describeTimeout = 30 * time.Second
+	// EC2 Query API version and maximum number of instance types per DescribeInstanceTypes request
+	apiVersion       = "2016-11-15"
+	maxInstanceTypes = 100
+)
+
+// instance type details returned by DescribeInstanceTypes
+type instanceTypeInfo struct {
+	InstanceType  string   `xml:"instanceType"`
+	Vcpus         int      `xml:"vCpuInfo>defaultVCpus"`
+	Memorymib     int      `xml:"memoryInfo>sizeInMiB"`
+	Architectures []string `xml:"processorInfo>supportedArchitectures>item"`
+}
+
+type describeInstanceTypesResponse struct {
+	InstanceTypes []instanceTypeInfo `xml:"instanceTypeSet>item"`
+	NextToken     string             `xml:"nextToken"`
+}
+
+// EC2 Query API error response like "The following supplied instance types do not exist: [a1.foo, b2.bar]"
+type errorResponse struct {
+	Messages []string `xml:"Errors>Error>Message"`
+}
+
+// error of a DescribeInstanceTypes request rejected because of unknown instance types, instancetypes is empty if EC2 did not name them
+type invalidInstanceTypesError struct {
+	instancetypes []string
+}
+
+func (e *invalidInstanceTypesError) Error() string {
+	return fmt.Sprintf("unknown EC2 instance types %s", strings.Join(e.instancetypes, ","))
+}
+
+// list of unknown instance types in the message of an InvalidInstanceType error
+var invalidInstanceTypesPattern = regexp.MustCompile(`\[([^\]]*)\]`)
+
+var enrichEnabled bool
+var ec2Region string
+var awsConfig aws.Config
+var once sync.Once
+var configErr error
+
+// EC2 Query API endpoint, empty means the regional endpoint "https://ec2.<region>.amazonaws.com/"
+var endpoint string
+
+// cache of instance type details, instance types unknown to EC2 are cached with empty details as well
+var cachemutex sync.Mutex
+var instancetypecache = make(map[string]instanceTypeInfo)
+
+// Initialize EC2 enrichment configuration from environment variables
+func init() {
+	enrichEnabled, _ = strconv.ParseBool(os.Getenv(enrichEnv))
+	ec2Region = os.Getenv(ec2RegionEnv)
+	if enrichEnabled {
+		fmt.Fprintf(os.Stderr, "EC2 instance type enrichment enabled\n")
+	}
+}
+
+// getAWSConfig returns the cached AWS SDK config, loading it once on first call
+func getAWSConfig(ctx context.Context) (aws.Config, error) {
+	once.Do(func() {
+		cfgCtx, cancel := context.WithTimeout(ctx, configTimeout)
+		defer cancel()
+		var optFns []func(*config.LoadOptions) error
+		if ec2Region != "" {
+			optFns = append(optFns, config.WithRegion(ec2Region))
+		}
+		awsConfig, configErr = config.LoadDefaultConfig(cfgCtx, optFns...)
+		if configErr != nil {
+			configErr = fmt.Errorf("unable to load AWS SDK config: %w", configErr)
+			return
+		}
+		if awsConfig.Region == "" {
+			awsConfig.Region = "us-east-1"
+		}
+	})
+	return awsConfig, configErr
+}
+
+// IsEnabled returns whether EC2 instance type enrichment is configured
+func IsEnabled() bool {
+	return enrichEnabled
+}
+
+// EnrichInstanceTypes sets Vcpus, Memorymib and Arch of all launched nodeclaims from EC2 DescribeInstanceTypes
+// every instance type is described only once and cached, unknown instance types leave the fields empty
+func EnrichInstanceTypes(nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
+	if !enrichEnabled {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	cachemutex.Lock()
+	defer cachemutex.Unlock()
+	var missing []string
+	for _, v := range *nodeclaimmap {
+		if _, ok := instancetypecache[v.Instancetype]; !ok && v.Instancetype != "" {
+			instancetypecache[v.Instancetype] = instanceTypeInfo{}
+			missing = append(missing, v.Instancetype)
+		}
+	}
+	for len(missing) > 0 {
+		batch := missing[:min(len(missing), maxInstanceTypes)]
+		missing = missing[len(batch):]
+		if err := describeBatch(ctx, batch); err != nil {
+			// allow retry of this and all later batches on next call
+			for _, instancetype := range slices.Concat(batch, missing) {
+				delete(instancetypecache, instancetype)
+			}
+			return err
+		}
+	}
+	for k, v := range *nodeclaimmap {
+		if info, ok := instancetypecache[v.Instancetype]; ok {
+			v.Vcpus = info.Vcpus
+			v.Memorymib = info.Memorymib
+			v.Arch = strings.Join(info.Architectures, "|")
+			(*nodeclaimmap)[k] = v
+		}
+	}
+	return nil
+}
+
+// internal function to describe a batch of instance types, EC2 rejects the whole request if a single instance type is unknown
+// unknown instance types named by EC2 are dropped and the rest is retried, otherwise the instance types are described one at a time
+// unknown instance types stay cached with empty details
+func describeBatch(ctx context.Context, batch []string) error {
+	for len(batch) > 0 {
+		err := describeInstanceTypes(ctx, batch)
+		var invalid *invalidInstanceTypesError
+		if !errors.As(err, &invalid) {
+			return err
+		}
+		remaining := slices.DeleteFunc(slices.Clone(batch), func(instancetype string) bool {
+			return slices.Contains(invalid.instancetypes, instancetype)
+		})
+		switch {
+		case len(batch) == 1:
+			fmt.Fprintf(os.Stderr, "Warning: EC2 does not know instance type %s\n", batch[0])
+			return nil
+		case len(remaining) == len(batch):
+			// EC2 did not name any instance type of batch
+			for _, instancetype := range batch {
+				if err := describeBatch(ctx, []string{instancetype}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Warning: EC2 does not know instance types %s\n", strings.Join(invalid.instancetypes, ","))
+		batch = remaining
+	}
+	return nil
+}
+
+// internal function to call EC2 DescribeInstanceTypes via Query API for the given instance types and cache the results
+func describeInstanceTypes(ctx context.Context, instancetypes []string) error {
+	cfg, err := getAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve AWS credentials: %w", err)
+	}
+	var nexttoken string
+	for {
+		params := url.Values{}
+		params.Set("Action", "DescribeInstanceTypes")
+		params.Set("Version", apiVersion)
+		for i, instancetype := range instancetypes {
+			params.Set(fmt.Sprintf("InstanceType.%d", i+1), instancetype)
+		}
+		if nexttoken != "" {
+			params.Set("NextToken", nexttoken)
+		}
+		body := params.Encode()
+		ec2url := endpoint
+		if ec2url == "" {
+			ec2url = fmt.Sprintf("https://ec2.%s.amazonaws.com/", cfg.Region)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ec2url, strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		payloadhash := sha256.Sum256([]byte(body))
+		if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadhash[:]), "ec2", cfg.Region, time.Now()); err != nil {
+			return fmt.Errorf("unable to sign EC2 request: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to describe EC2 instance types: %w", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read EC2 response: %w", err)
+		}
+		// EC2 rejects the whole request if a single instance type is unknown
+		if resp.StatusCode == http.StatusBadRequest && strings.Contains(string(data), "InvalidInstanceType") {
+			invalid := &invalidInstanceTypesError{}
+			var result errorResponse
+			if err := xml.Unmarshal(data, &result); err == nil {
+				for _, message := range result.Messages {
+					if matchslice := invalidInstanceTypesPattern.FindStringSubmatch(message); matchslice != nil {
+						for instancetype := range strings.SplitSeq(matchslice[1], ",") {
+							if instancetype = strings.TrimSpace(instancetype); instancetype != "" {
+								invalid.instancetypes = append(invalid.instancetypes, instancetype)
+							}
+						}
+					}
+				}
+			}
+			return invalid
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to describe EC2 instance types: %s", resp.Status)
+		}
+		var result describeInstanceTypesResponse
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("failed to decode EC2 response: %w", err)
+		}
+		for _, info := range result.InstanceTypes {
+			instancetypecache[info.InstanceType] = info
+		}
+		if nexttoken = result.NextToken; nexttoken == "" {
+			return nil
+		}
+	}
+}
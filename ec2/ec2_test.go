@@ -0,0 +1,132 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+)
+
+// known instance types of the fake EC2 endpoint
+var fakeinstancetypes = map[string]string{
+	"m5.large":  "<vCpuInfo><defaultVCpus>2</defaultVCpus></vCpuInfo><memoryInfo><sizeInMiB>8192</sizeInMiB></memoryInfo><processorInfo><supportedArchitectures><item>x86_64</item></supportedArchitectures></processorInfo>",
+	"m7g.large": "<vCpuInfo><defaultVCpus>2</defaultVCpus></vCpuInfo><memoryInfo><sizeInMiB>8192</sizeInMiB></memoryInfo><processorInfo><supportedArchitectures><item>arm64</item></supportedArchitectures></processorInfo>",
+}
+
+// internal helper function to serve DescribeInstanceTypes like EC2, failing with status if not 0 and naming unknown instance types if nameinvalid
+// returns the instance types of every request
+func fakeEC2(t *testing.T, status int, nameinvalid bool) *[][]string {
+	t.Helper()
+	var requests [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		var requested, unknown []string
+		for i := 1; r.PostForm.Has(fmt.Sprintf("InstanceType.%d", i)); i++ {
+			instancetype := r.PostForm.Get(fmt.Sprintf("InstanceType.%d", i))
+			requested = append(requested, instancetype)
+			if _, ok := fakeinstancetypes[instancetype]; !ok {
+				unknown = append(unknown, instancetype)
+			}
+		}
+		requests = append(requests, requested)
+		switch {
+		case status != 0:
+			w.WriteHeader(status)
+		case len(unknown) > 0:
+			message := "The following supplied instance types do not exist"
+			if nameinvalid {
+				message += fmt.Sprintf(": [%s]", strings.Join(unknown, ", "))
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<Response><Errors><Error><Code>InvalidInstanceType</Code><Message>%s</Message></Error></Errors></Response>", message)
+		default:
+			fmt.Fprint(w, "<DescribeInstanceTypesResponse><instanceTypeSet>")
+			for _, instancetype := range requested {
+				fmt.Fprintf(w, "<item><instanceType>%s</instanceType>%s</item>", instancetype, fakeinstancetypes[instancetype])
+			}
+			fmt.Fprint(w, "</instanceTypeSet></DescribeInstanceTypesResponse>")
+		}
+	}))
+	t.Cleanup(server.Close)
+	endpoint = server.URL
+	enrichEnabled = true
+	instancetypecache = make(map[string]instanceTypeInfo)
+	once.Do(func() {
+		awsConfig = aws.Config{Region: "us-east-1", Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		})}
+	})
+	t.Cleanup(func() { endpoint, enrichEnabled = "", false })
+	return &requests
+}
+
+// internal helper function to return nodeclaims of the given instance types
+func nodeclaims(instancetypes ...string) *map[string]lp4k.Nodeclaimstruct {
+	nodeclaimmap := make(map[string]lp4k.Nodeclaimstruct)
+	for i, instancetype := range instancetypes {
+		nodeclaimmap[fmt.Sprintf("default-%d", i)] = lp4k.Nodeclaimstruct{Instancetype: instancetype}
+	}
+	return &nodeclaimmap
+}
+
+func TestEnrichInstanceTypes(t *testing.T) {
+	requests := fakeEC2(t, 0, true)
+	nodeclaimmap := nodeclaims("m5.large", "m7g.large")
+	if err := EnrichInstanceTypes(nodeclaimmap); err != nil {
+		t.Fatalf("EnrichInstanceTypes failed: %v", err)
+	}
+	if got := (*nodeclaimmap)["default-1"]; got.Vcpus != 2 || got.Memorymib != 8192 || got.Arch != "arm64" {
+		t.Errorf("unexpected enrichment %+v", got)
+	}
+	if len(*requests) != 1 {
+		t.Errorf("expected one request for one batch, got %v", *requests)
+	}
+}
+
+func TestEnrichInstanceTypesInvalid(t *testing.T) {
+	for _, nameinvalid := range []bool{true, false} {
+		requests := fakeEC2(t, 0, nameinvalid)
+		nodeclaimmap := nodeclaims("m5.large", "x9.unknown", "m7g.large")
+		if err := EnrichInstanceTypes(nodeclaimmap); err != nil {
+			t.Fatalf("EnrichInstanceTypes failed: %v", err)
+		}
+		// one unknown instance type must not block enrichment of the valid ones of its batch
+		for name, nc := range *nodeclaimmap {
+			if known := nc.Instancetype != "x9.unknown"; known != (nc.Vcpus == 2) {
+				t.Errorf("nameinvalid=%v: unexpected enrichment of %s %+v", nameinvalid, name, nc)
+			}
+		}
+		if _, ok := instancetypecache["x9.unknown"]; !ok {
+			t.Errorf("nameinvalid=%v: expected unknown instance type to stay cached", nameinvalid)
+		}
+		if nameinvalid && (len(*requests) != 2 || slices.Contains((*requests)[1], "x9.unknown")) {
+			t.Errorf("expected retry without unknown instance type, got %v", *requests)
+		}
+	}
+}
+
+func TestEnrichInstanceTypesFailed(t *testing.T) {
+	fakeEC2(t, http.StatusInternalServerError, true)
+	instancetypes := make([]string, maxInstanceTypes+1)
+	for i := range instancetypes {
+		instancetypes[i] = fmt.Sprintf("m5.%dxlarge", i)
+	}
+	if err := EnrichInstanceTypes(nodeclaims(instancetypes...)); err == nil {
+		t.Fatalf("expected error for failed request")
+	}
+	// the failed batch and all later batches are retried on the next call
+	if len(instancetypecache) != 0 {
+		t.Errorf("expected no cached instance types after failed batch, got %d", len(instancetypecache))
+	}
+}
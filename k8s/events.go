@@ -0,0 +1,70 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+)
+
+const (
+	// environment variables
+	eventsEnv          = "LP4K_EVENTS"
+	eventsnamespaceEnv = "LP4K_EVENTS_NAMESPACE"
+)
+
+// watch Kubernetes Events of NodeClaims and Nodes in addition to Karpenter logs
+var events bool
+
+// namespace of watched Events, Events of cluster-scoped NodeClaims and Nodes are recorded in "default"
+var eventsnamespace string
+
+// internal helper function to determine Events watch configuration via OS environment
+func init() {
+	events = getEnvBool(eventsEnv, false)
+	eventsnamespace = getEnvOrDefault(eventsnamespaceEnv, "default")
+}
+
+// internal helper function to check if an Event was emitted by Karpenter, other controllers like kubelet also emit Node Events
+func isKarpenterEvent(event *v1.Event) bool {
+	return strings.Contains(event.Source.Component, "karpenter") || strings.Contains(event.ReportingController, "karpenter")
+}
+
+// internal helper function to return the most specific time of an Event, Events API v1 only sets EventTime
+func eventTime(event *v1.Event) string {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.UTC().Format(time.RFC3339)
+	case !event.EventTime.IsZero():
+		return event.EventTime.UTC().Format(time.RFC3339)
+	}
+	return event.FirstTimestamp.UTC().Format(time.RFC3339)
+}
+
+// internal function to watch Karpenter Events in LP4K_EVENTS_NAMESPACE with an informer and correlate them onto nodeclaimmap via involvedObject with logparser
+// the informer stops when stop is closed
+func watchKarpenterEvents(clientSet kubernetes.Interface, logparser *lp4k.Parser, store *lp4k.Nodeclaimstore, stop <-chan struct{}) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientSet, 0, informers.WithNamespace(eventsnamespace))
+	update := func(obj any) {
+		if event, ok := obj.(*v1.Event); ok && isKarpenterEvent(event) {
+			store.Update(func(nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) {
+				logparser.ParseKubernetesEvent(eventTime(event), event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Reason, event.Message, nodeclaimmap, k8snodenamemap)
+			})
+		}
+	}
+	factory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+	})
+	fmt.Fprintf(os.Stderr, "\nWatching Karpenter Events in namespace \"%s\"\n", eventsnamespace)
+	factory.Start(stop)
+}
@@ -0,0 +1,146 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package k8s
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+)
+
+const (
+	// environment variables
+	healthaddrEnv  = "LP4K_HEALTH_ADDR"
+	metricsaddrEnv = "LP4K_METRICS_ADDR"
+	pprofaddrEnv   = "LP4K_PPROF_ADDR"
+)
+
+// listen address of probe endpoints like ":8081", empty disables the endpoints
+var healthaddr string
+
+// listen address of the metrics endpoint, defaults to LP4K_HEALTH_ADDR if set and ":8080" otherwise, so cluster mode always serves metrics unless set empty
+var metricsaddr string
+
+// listen address of pprof endpoints like "localhost:6060", empty (default) disables them because profiles expose internals
+var pprofaddr string
+
+// ConfigMap write health, updated by nodeclaimsConfigMap and read concurrently by HTTP handlers
+var lastcmwrite atomic.Int64
+var cmwritefailures atomic.Int64
+
+// internal helper function to determine probe listen address via OS environment
+func init() {
+	healthaddr = os.Getenv(healthaddrEnv)
+	if val, ok := os.LookupEnv(metricsaddrEnv); ok {
+		metricsaddr = val
+	} else if healthaddr != "" {
+		metricsaddr = healthaddr
+	} else {
+		metricsaddr = ":8080"
+	}
+	pprofaddr = os.Getenv(pprofaddrEnv)
+}
+
+// internal helper function to record the result of a ConfigMap create or update
+func recordConfigMapWrite(err error) {
+	if err != nil {
+		cmwritefailures.Add(1)
+		return
+	}
+	lastcmwrite.Store(time.Now().UnixNano())
+	cmwritefailures.Store(0)
+}
+
+// internal helper function to return the /readyz handler, which requires a successful ConfigMap write within 2x LP4K_CM_UPDATE_FREQ if cmsink is set
+// without ConfigMap sink there are no ConfigMap writes to wait for, so lp4k is always ready
+func readyz(cmsink bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if since := time.Since(time.Unix(0, lastcmwrite.Load())); cmsink && since > 2*cmupdfreq {
+			http.Error(w, fmt.Sprintf("last successful ConfigMap write %s ago", since.Round(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// internal helper function to return the /metrics handler serving ConfigMap write health and the metrics of logparser
+func metrics(logparser *lp4k.Parser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# HELP lp4k_configmap_write_failures_consecutive Number of consecutive failed ConfigMap writes.\n")
+		fmt.Fprintf(w, "# TYPE lp4k_configmap_write_failures_consecutive gauge\n")
+		fmt.Fprintf(w, "lp4k_configmap_write_failures_consecutive %d\n", cmwritefailures.Load())
+		// streaming estimates, so scraping stays cheap in long-running sessions with many nodeclaims
+		count, values := logparser.NodereadyQuantiles()
+		fmt.Fprintf(w, "# HELP lp4k_node_ready_seconds Estimated node ready time quantiles of nodeclaims initialized since start.\n")
+		fmt.Fprintf(w, "# TYPE lp4k_node_ready_seconds summary\n")
+		for i, q := range lp4k.Quantiles {
+			fmt.Fprintf(w, "lp4k_node_ready_seconds{quantile=\"%g\"} %g\n", q, values[i])
+		}
+		fmt.Fprintf(w, "lp4k_node_ready_seconds_count %d\n", count)
+		logparser.WriteMetrics(w)
+	}
+}
+
+// internal function to serve /healthz and /readyz if LP4K_HEALTH_ADDR is set and /metrics if LP4K_METRICS_ADDR is not empty
+// /metrics serves the metrics of logparser, /healthz reports the process is alive, /readyz requires a successful ConfigMap write within 2x LP4K_CM_UPDATE_FREQ
+// if sinks contain the ConfigMap sink, /metrics shares the listener of the probe endpoints if both addresses are equal
+func startHealthServer(logparser *lp4k.Parser, sinks []lp4k.Sink) {
+	if healthaddr != "" {
+		// grace period for the first ConfigMap write after start
+		lastcmwrite.Store(time.Now().UnixNano())
+		mux := http.NewServeMux()
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "ok")
+		})
+		mux.HandleFunc("/readyz", readyz(slices.ContainsFunc(sinks, func(sink lp4k.Sink) bool { return sink.Name() == "configmap" })))
+		endpoints := "/healthz and /readyz"
+		if metricsaddr == healthaddr {
+			mux.HandleFunc("/metrics", metrics(logparser))
+			endpoints = "/healthz, /readyz and /metrics"
+		}
+		fmt.Fprintf(os.Stderr, "\nServing %s on \"%s\"\n", endpoints, healthaddr)
+		go func() {
+			if err := http.ListenAndServe(healthaddr, mux); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to serve probe endpoints on \"%s\": %v\n", healthaddr, err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if metricsaddr != "" && metricsaddr != healthaddr {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", metrics(logparser))
+		fmt.Fprintf(os.Stderr, "\nServing /metrics on \"%s\"\n", metricsaddr)
+		// metrics are served by default, so an address in use does not end streaming
+		go func() {
+			if err := http.ListenAndServe(metricsaddr, mux); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to serve /metrics on \"%s\": %v - set %s to another address or empty to disable it\n", metricsaddr, err, metricsaddrEnv)
+			}
+		}()
+	}
+}
+
+// internal function to serve net/http/pprof endpoints under /debug/pprof/ if LP4K_PPROF_ADDR is set
+func startPprofServer() {
+	if pprofaddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	fmt.Fprintf(os.Stderr, "\nServing /debug/pprof/ on \"%s\"\n", pprofaddr)
+	go func() {
+		if err := http.ListenAndServe(pprofaddr, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to serve pprof endpoints on \"%s\": %v\n", pprofaddr, err)
+			os.Exit(1)
+		}
+	}()
+}
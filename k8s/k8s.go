@@ -5,19 +5,37 @@ package k8s
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	authorizationv1 "k8s.io/api/authorization/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 
+	"github.com/awslabs/LogParserForKarpenter/ec2"
 	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+	"github.com/awslabs/LogParserForKarpenter/remotewrite"
 	"github.com/awslabs/LogParserForKarpenter/s3"
 )
 
@@ -28,18 +46,43 @@ const (
 	updateEnv            = "LP4K_CM_UPDATE_FREQ"
 	configmapEnv         = "LP4K_CM_PREFIX"
 	configmapoverrideEnv = "LP4K_CM_OVERRIDE"
+	cmnamespaceEnv       = "LP4K_CM_NAMESPACE"
+	cmretentionEnv       = "LP4K_CM_RETENTION"
+	cmlayoutEnv          = "LP4K_CM_LAYOUT"
+	runforEnv            = "LP4K_RUN_FOR"
+	maxstreamsEnv        = "LP4K_MAX_STREAMS"
+	inclusterEnv         = "LP4K_IN_CLUSTER"
 	nodeclaimprintEnv    = " LP4K_NODECLAIM_PRINT"
+	// limits of ConfigMap update frequency
+	minCMUpdateFreq  = 1 * time.Second
+	warnCMUpdateFreq = 5 * time.Second
 )
 
-var namespace, label, configmappref, configmap string
-var cmupdfreq time.Duration
+// annotation of lp4k ConfigMaps with the SHA-256 checksum of their data
+const checksumAnnotation = "lp4k.awslabs.com/data-checksum"
+
+var namespace, cmnamespace, label, configmappref, configmap, cmlayout string
+
+// characters not allowed in DNS subdomain ConfigMap names
+var dnsUnsafePattern = regexp.MustCompile(`[^-.a-z0-9]+`)
+var cmupdfreq, cmretention, runfor time.Duration
 var cmoverride, nodeclaimprint bool
 
+// lp4k ConfigMap to load nodeclaims from before streaming and to update afterwards, empty means start empty
+var resumefrom string
+
+// maximum number of concurrent pod log streams, 0 means one stream per pod
+var maxstreams int
+
+// connect with the ServiceAccount of the pod lp4k runs in instead of a kubeconfig
+var incluster bool
+
 // internal helper function to determine Karpenter namespace and label via OS environment, if not set use defaults
 // handle ConfigMap override logic as well
 func init() {
 	var err error
 	namespace = getEnvOrDefault(namespaceEnv, "kube-system")
+	cmnamespace = getEnvOrDefault(cmnamespaceEnv, namespace)
 	label = getEnvOrDefault(labelEnv, "app.kubernetes.io/name=karpenter")
 	cmupdfreqstr := getEnvOrDefault(updateEnv, "30s")
 	cmupdfreq, err = time.ParseDuration(cmupdfreqstr)
@@ -47,9 +90,43 @@ func init() {
 		fmt.Fprintf(os.Stderr, "Invalid environment variable CM_UPDATE_FREQ, must be a valid time.Duration format like \"30s\" or \"2m10s\"\n")
 		os.Exit(1)
 	}
+	// protect kube-apiserver from too frequent ConfigMap updates
+	if cmupdfreq < minCMUpdateFreq {
+		fmt.Fprintf(os.Stderr, "Invalid environment variable %s \"%s\", must not be less than %s\n", updateEnv, cmupdfreqstr, minCMUpdateFreq)
+		os.Exit(1)
+	} else if cmupdfreq < warnCMUpdateFreq {
+		fmt.Fprintf(os.Stderr, "Warning: Environment variable %s \"%s\" is less than %s, this results in frequent ConfigMap updates\n", updateEnv, cmupdfreqstr, warnCMUpdateFreq)
+	}
 	configmappref = getEnvOrDefault(configmapEnv, "lp4k-cm")
 	cmoverride = getEnvBool(configmapoverrideEnv, false)
+	switch cmlayout = getEnvOrDefault(cmlayoutEnv, "single"); cmlayout {
+	case "single", "nodepool":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid environment variable %s \"%s\", must be \"single\" or \"nodepool\"\n", cmlayoutEnv, cmlayout)
+		os.Exit(1)
+	}
+	// negative retention keeps all seeded nodeclaims
+	cmretention = -1
+	if val := os.Getenv(cmretentionEnv); val != "" {
+		if cmretention, err = time.ParseDuration(val); err != nil || cmretention < 0 {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s \"%s\", must be a valid non-negative time.Duration format like \"24h\" or \"0s\"\n", cmretentionEnv, val)
+			os.Exit(1)
+		}
+	}
 	nodeclaimprint = getEnvBool(nodeclaimprintEnv, true)
+	incluster = getEnvBool(inclusterEnv, false)
+	if val := os.Getenv(runforEnv); val != "" {
+		if runfor, err = time.ParseDuration(val); err != nil || runfor <= 0 {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s \"%s\", must be a positive time.Duration format like \"10m\"\n", runforEnv, val)
+			os.Exit(1)
+		}
+	}
+	if val := os.Getenv(maxstreamsEnv); val != "" {
+		if maxstreams, err = strconv.Atoi(val); err != nil || maxstreams <= 0 {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s \"%s\", must be a positive number of streams\n", maxstreamsEnv, val)
+			os.Exit(1)
+		}
+	}
 }
 
 func getEnvOrDefault(key, defaultVal string) string {
@@ -68,115 +145,627 @@ func getEnvBool(key string, defaultVal bool) bool {
 	return b
 }
 
-func ConnectToK8s(kubeconfig *string) (context.Context, *kubernetes.Clientset) {
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+// connect to K8s cluster using kubeconfig, kubecontext and cluster select a context and/or cluster other than the current context if not empty
+// an empty kubeconfig uses the ":" separated KUBECONFIG paths or "~/.kube/config" like kubectl
+// with LP4K_IN_CLUSTER=true, or if no kubeconfig exists while running in a pod, the ServiceAccount of the pod is used instead
+func ConnectToK8s(kubeconfig *string, kubecontext string, cluster string) (context.Context, *kubernetes.Clientset) {
+	ctx, clientSet, err := TryConnectToK8s(kubeconfig, kubecontext, cluster)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to build config from flags - %s\n", err.Error())
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(1)
 	}
+	return ctx, clientSet
+}
+
+// TryConnectToK8s connects to K8s cluster like ConnectToK8s, but returns an error instead of exiting, so callers can continue with other clusters
+func TryConnectToK8s(kubeconfig *string, kubecontext string, cluster string) (context.Context, *kubernetes.Clientset, error) {
+	config, err := restConfig(kubeconfig, kubecontext, cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	// EKS kubeconfigs usually reference an exec credential plugin like "aws eks get-token" or "aws-iam-authenticator"
+	if err := checkExecProvider(config); err != nil {
+		return nil, nil, err
+	}
 	clientSet, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create clientset from the given config - %s\n", err.Error())
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("Failed to create clientset from the given config - %s", err.Error())
+	}
+	// credentials of exec plugins are retrieved lazily, so check them with a cheap request to get a meaningful error
+	if _, err := clientSet.Discovery().ServerVersion(); err != nil {
+		if config.ExecProvider != nil {
+			return nil, nil, fmt.Errorf("Failed to connect to K8s cluster using exec credential plugin \"%s\" - %s\nMake sure \"%s %s\" returns valid credentials for the cluster",
+				config.ExecProvider.Command, err.Error(), config.ExecProvider.Command, strings.Join(config.ExecProvider.Args, " "))
+		}
+		return nil, nil, fmt.Errorf("Failed to connect to K8s cluster - %s", err.Error())
 	}
 	fmt.Fprintf(os.Stderr, "Connected to K8s cluster\n")
-	return context.Background(), clientSet
+	return context.Background(), clientSet, nil
+}
+
+// internal helper function to build the client config from kubeconfig, or from the ServiceAccount of the pod lp4k runs in
+// with LP4K_IN_CLUSTER=true or if no kubeconfig exists at all while running in a pod, like lp4k deployed as a Deployment
+func restConfig(kubeconfig *string, kubecontext string, cluster string) (*rest.Config, error) {
+	if incluster {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load in-cluster config with %s=true - %s", inclusterEnv, err.Error())
+		}
+		fmt.Fprintf(os.Stderr, "Using in-cluster config with ServiceAccount of pod, ignoring kubeconfig, context and cluster\n")
+		return config, nil
+	}
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = *kubeconfig
+	// name used in error messages only, kubeconfig itself is kept, so repeated connections load the same files
+	kubeconfigname := *kubeconfig
+	if kubeconfigname == "" {
+		kubeconfigname = strings.Join(loadingRules.GetLoadingPrecedence(), string(filepath.ListSeparator))
+	}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubecontext, Context: clientcmdapi.Context{Cluster: cluster}})
+	// validate named context and cluster upfront, clientcmd errors are not very helpful here
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load kubeconfig \"%s\" - %s", kubeconfigname, err.Error())
+	}
+	// fall back to the ServiceAccount of the pod if neither -kubeconfig, KUBECONFIG nor "~/.kube/config" provide a config
+	if *kubeconfig == "" && kubecontext == "" && cluster == "" && clientcmdapi.IsConfigEmpty(&rawConfig) {
+		if config, err := rest.InClusterConfig(); err == nil {
+			fmt.Fprintf(os.Stderr, "No kubeconfig \"%s\" found, using in-cluster config with ServiceAccount of pod\n", kubeconfigname)
+			return config, nil
+		}
+	}
+	if _, ok := rawConfig.Contexts[kubecontext]; kubecontext != "" && !ok {
+		return nil, fmt.Errorf("Context \"%s\" does not exist in kubeconfig \"%s\"", kubecontext, kubeconfigname)
+	}
+	if _, ok := rawConfig.Clusters[cluster]; cluster != "" && !ok {
+		return nil, fmt.Errorf("Cluster \"%s\" does not exist in kubeconfig \"%s\"", cluster, kubeconfigname)
+	}
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build config from flags - %s", err.Error())
+	}
+	return config, nil
+}
+
+// internal helper function to verify that the exec credential plugin referenced by kubeconfig is installed
+func checkExecProvider(config *rest.Config) error {
+	if config.ExecProvider == nil {
+		return nil
+	}
+	if _, err := exec.LookPath(config.ExecProvider.Command); err != nil {
+		msg := fmt.Sprintf("Exec credential plugin \"%s\" referenced by kubeconfig not found in PATH - %s", config.ExecProvider.Command, err.Error())
+		if config.ExecProvider.InstallHint != "" {
+			msg += "\n" + config.ExecProvider.InstallHint
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// SetResumeFrom sets the lp4k ConfigMap whose nodeclaims are loaded at the start of CollectKarpenterLogs and which is updated afterwards
+func SetResumeFrom(cm string) {
+	resumefrom = cm
 }
 
 // function to read nodeclaims from existing ConfigMap, required by tool lp4kcm as well!
-func ReadnodeclaimsConfigMap(ctx context.Context, clientSet *kubernetes.Clientset, configmap string, nodeclaimmap *map[string]lp4k.Nodeclaimstruct) {
+func ReadnodeclaimsConfigMap(ctx context.Context, clientSet kubernetes.Interface, configmap string, nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
 	// use unique ConfigMap name and override on every start
-	fmt.Fprintf(os.Stderr, "\nRead existing ConfigMap \"%s\" in namespace \"%s\"\n", configmap, namespace)
-	cm, err := clientSet.CoreV1().ConfigMaps(namespace).Get(ctx, configmap, metav1.GetOptions{})
+	fmt.Fprintf(os.Stderr, "\nRead existing ConfigMap \"%s\" in namespace \"%s\"\n", configmap, cmnamespace)
+	cm, err := clientSet.CoreV1().ConfigMaps(cmnamespace).Get(ctx, configmap, metav1.GetOptions{})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get ConfigMap \"%s\" in namespace \"%s\" - %s\n", configmap, namespace, err.Error())
-		os.Exit(1)
+		return fmt.Errorf("failed to get ConfigMap \"%s\" in namespace \"%s\": %w", configmap, cmnamespace, err)
 	}
 	// populate nodeclaimmap from ConfigMap data
 	lp4k.Populatenodeclaimmap(nodeclaimmap, cm.Data)
+	return nil
 }
 
-// internal function to create and write ConfigMap with nodeclaims
-func nodeclaimsConfigMap(ctx context.Context, clientSet *kubernetes.Clientset, nodeclaimmap *map[string]lp4k.Nodeclaimstruct) {
-	// print current results every cmupdfreq seconds
-	// create ConfigMap in same namespace like Karpenter namespace
-	// ConfigMap data has to be map[string]string
-	if cmoverride {
-		// use unique ConfigMap name and override on every start
-		configmap = configmappref
-	} else {
-		// construct ConfigMap name from time stamp
-		configmap = fmt.Sprintf("%s-%s", configmappref, s3.GetStartTimestamp())
+// ReadnodeclaimsConfigMaps reads the nodeclaims of all lp4k ConfigMaps of cmargs into nodeclaimmap, required by tool lp4kcm and "lp4k cm"
+// "<context>:<ConfigMap name>" reads from the cluster of another kubeconfig context, one connection per context is reused for all its ConfigMaps
+// failing connections and ConfigMaps do not stop reading the others, the result per argument is printed and all failed arguments are returned as error
+func ReadnodeclaimsConfigMaps(kubeconfig *string, kubecontext string, cluster string, cmargs []string, nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
+	return readConfigMaps(cmargs, kubecontext, cluster, func(kubecontext string, cluster string) (context.Context, kubernetes.Interface, error) {
+		return TryConnectToK8s(kubeconfig, kubecontext, cluster)
+	}, nodeclaimmap)
+}
+
+// internal helper function to read ConfigMaps like ReadnodeclaimsConfigMaps with connect returning the connection of a kubeconfig context
+func readConfigMaps(cmargs []string, kubecontext string, cluster string, connect func(kubecontext string, cluster string) (context.Context, kubernetes.Interface, error), nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
+	// one connection per kubeconfig context, "" is the context selected by kubecontext and cluster
+	type connection struct {
+		ctx       context.Context
+		clientSet kubernetes.Interface
+		err       error
+	}
+	connections := make(map[string]connection)
+	var failed []string
+	for _, arg := range cmargs {
+		// "<context>:<ConfigMap name>" reads from another kubeconfig context, ConfigMap names never contain ":" but EKS context ARNs do
+		kubecontextname, clustername, cmname := kubecontext, cluster, arg
+		if i := strings.LastIndex(arg, ":"); i >= 0 {
+			kubecontextname, clustername, cmname = arg[:i], "", arg[i+1:]
+		}
+		conn, ok := connections[kubecontextname]
+		if !ok {
+			if kubecontextname != "" {
+				fmt.Fprintf(os.Stderr, "\nConnecting to K8s cluster of context \"%s\"\n", kubecontextname)
+			}
+			conn.ctx, conn.clientSet, conn.err = connect(kubecontextname, clustername)
+			connections[kubecontextname] = conn
+		}
+		if conn.err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", conn.err.Error())
+			failed = append(failed, arg)
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "\nParsing ConfigMap %s\n", cmname)
+
+		// main parsing logic, continue with the remaining ConfigMaps on failure
+		if err := ReadnodeclaimsConfigMap(conn.ctx, conn.clientSet, cmname, nodeclaimmap); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			failed = append(failed, arg)
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "Finished parsing ConfigMap %s\n", cmname)
+	}
+	// report per argument result
+	fmt.Fprintf(os.Stderr, "\nRead %d of %d ConfigMaps\n", len(cmargs)-len(failed), len(cmargs))
+	for _, arg := range cmargs {
+		result := "ok"
+		if slices.Contains(failed, arg) {
+			result = "failed"
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", arg, result)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to read ConfigMaps %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// DiffnodeclaimsConfigMaps returns all differing fields of nodeclaims present in both lp4k ConfigMaps oldcm and newcm, required by tool lp4kcm and "lp4k cm"
+func DiffnodeclaimsConfigMaps(ctx context.Context, clientSet kubernetes.Interface, oldcm string, newcm string) ([]lp4k.Fielddiff, error) {
+	oldmap := make(map[string]lp4k.Nodeclaimstruct)
+	newmap := make(map[string]lp4k.Nodeclaimstruct)
+	if err := ReadnodeclaimsConfigMap(ctx, clientSet, oldcm, &oldmap); err != nil {
+		return nil, err
+	}
+	if err := ReadnodeclaimsConfigMap(ctx, clientSet, newcm, &newmap); err != nil {
+		return nil, err
+	}
+	return lp4k.DiffNodeclaims(&oldmap, &newmap), nil
+}
+
+// WatchnodeclaimsConfigMap watches lp4k ConfigMap configmap with an informer and calls handler with its nodeclaims on every change until Ctrl-C
+func WatchnodeclaimsConfigMap(ctx context.Context, clientSet kubernetes.Interface, configmap string, handler func(nodeclaimmap *map[string]lp4k.Nodeclaimstruct)) {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientSet, 0, informers.WithNamespace(cmnamespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", configmap).String()
+		}))
+	// last handled checksum, ConfigMaps without checksum annotation are always handled
+	var lastchecksum string
+	update := func(obj any) {
+		if cm, ok := obj.(*v1.ConfigMap); ok {
+			// skip resyncs and updates without data change
+			checksum := cm.Annotations[checksumAnnotation]
+			if checksum != "" && checksum == lastchecksum {
+				return
+			}
+			lastchecksum = checksum
+			fmt.Fprintf(os.Stderr, "\nConfigMap \"%s/%s\" changed at %s\n", cmnamespace, configmap, time.Now().Format(time.RFC850))
+			nodeclaimmap := make(map[string]lp4k.Nodeclaimstruct)
+			lp4k.Populatenodeclaimmap(&nodeclaimmap, cm.Data)
+			handler(&nodeclaimmap)
+		}
+	}
+	factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		DeleteFunc: func(obj any) {
+			fmt.Fprintf(os.Stderr, "\nConfigMap \"%s/%s\" has been deleted\n", cmnamespace, configmap)
+		},
+	})
+	fmt.Fprintf(os.Stderr, "\nWatching ConfigMap \"%s\" in namespace \"%s\", type Ctrl-C to end program\n", configmap, cmnamespace)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	factory.Start(stop)
+	<-ch
+	close(stop)
+	factory.Shutdown()
+}
+
+// internal function to seed nodeclaimmap and k8snodenamemap from override ConfigMap of a previous run, a missing ConfigMap is not an error
+// with LP4K_CM_RETENTION deleted nodeclaims older than retention are not carried forward, in-progress nodeclaims always are
+func seedFromConfigMap(ctx context.Context, clientSet kubernetes.Interface, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) error {
+	fmt.Fprintf(os.Stderr, "\nRead existing ConfigMap \"%s\" in namespace \"%s\"\n", configmappref, cmnamespace)
+	cm, err := clientSet.CoreV1().ConfigMaps(cmnamespace).Get(ctx, configmappref, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		fmt.Fprintf(os.Stderr, "ConfigMap \"%s\" does not exist in namespace \"%s\" - starting empty\n", configmappref, cmnamespace)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get ConfigMap \"%s\" in namespace \"%s\": %w", configmappref, cmnamespace, err)
+	}
+	seeded := make(map[string]lp4k.Nodeclaimstruct)
+	lp4k.Populatenodeclaimmap(&seeded, cm.Data)
+	var dropped int
+	for k, v := range seeded {
+		if cmretention >= 0 && v.Deleted {
+			if deletedtime, err := time.Parse(time.RFC3339Nano, v.Deletedtime); err != nil || time.Since(deletedtime) > cmretention {
+				dropped++
+				continue
+			}
+		}
+		(*nodeclaimmap)[k] = v
+	}
+	// restore K8s node names, so node events of seeded nodeclaims are correlated
+	lp4k.Populatek8snodenamemap(nodeclaimmap, k8snodenamemap)
+	if dropped > 0 {
+		fmt.Fprintf(os.Stderr, "Dropped %d deleted nodeclaims older than %s from ConfigMap \"%s\"\n", dropped, cmretention, configmappref)
+	}
+	return nil
+}
+
+// internal helper function to return the verbs of "create" and "update" which are not allowed on ConfigMaps in the ConfigMap namespace
+func deniedConfigMapVerbs(ctx context.Context, clientSet kubernetes.Interface) ([]string, error) {
+	var denied []string
+	for _, verb := range []string{"create", "update"} {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: cmnamespace,
+					Verb:      verb,
+					Resource:  "configmaps",
+				},
+			},
+		}
+		result, err := clientSet.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check access to ConfigMaps in namespace \"%s\": %w", cmnamespace, err)
+		}
+		if !result.Status.Allowed {
+			denied = append(denied, verb)
+		}
+	}
+	return denied, nil
+}
+
+// internal helper function to warn if ConfigMap namespace differs from Karpenter namespace and ConfigMaps cannot be written there
+func checkConfigMapNamespace(ctx context.Context, clientSet kubernetes.Interface) {
+	if cmnamespace == namespace {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\nWarning: ConfigMap namespace \"%s\" differs from Karpenter namespace \"%s\"\n", cmnamespace, namespace)
+	denied, err := deniedConfigMapVerbs(ctx, clientSet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err.Error())
+		return
 	}
-	fmt.Fprintf(os.Stderr, "\nUsing ConfigMap \"%s\" in namespace \"%s\" with updates every %s\n", configmap, namespace, cmupdfreq.String())
-	cm := v1.ConfigMap{
+	for _, verb := range denied {
+		fmt.Fprintf(os.Stderr, "Warning: Not allowed to %s ConfigMaps in namespace \"%s\"\n", verb, cmnamespace)
+	}
+}
+
+// configMapSink writes nodeclaims into the lp4k ConfigMap or with LP4K_CM_LAYOUT=nodepool into one ConfigMap per nodepool
+type configMapSink struct {
+	ctx       context.Context
+	clientSet kubernetes.Interface
+	// created ConfigMaps by name
+	cms map[string]*v1.ConfigMap
+	// checksum of the data of the last successful update by ConfigMap name
+	checksums map[string]string
+}
+
+func (c *configMapSink) Name() string {
+	return "configmap"
+}
+
+func (c *configMapSink) Write(nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
+	// get actual data from nodeclaimmap
+	data, skipped := lp4k.ConvertResult(nodeclaimmap)
+	if len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "\nSkipped %d nodeclaims with invalid names: %s\n", len(skipped), strings.Join(skipped, ","))
+	}
+	cmdata := map[string]map[string]string{configmap: data}
+	if cmlayout == "nodepool" {
+		cmdata = make(map[string]map[string]string)
+		for k, v := range data {
+			name := nodepoolConfigMapName((*nodeclaimmap)[k].Nodepool)
+			if cmdata[name] == nil {
+				cmdata[name] = make(map[string]string)
+			}
+			cmdata[name][k] = v
+		}
+	}
+	var errs []error
+	for name, data := range cmdata {
+		cm, ok := c.cms[name]
+		if !ok {
+			var err error
+			if cm, err = c.create(name); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		// skip update in idle intervals, ConfigMap is still considered healthy
+		checksum := dataChecksum(data)
+		if c.checksums[name] == checksum {
+			fmt.Fprintf(os.Stderr, "\nConfigMap \"%s\" unchanged - skipping update\n", name)
+			continue
+		}
+		// update a copy, so a failed update is retried with the same data on the next write
+		updated := cm.DeepCopy()
+		updated.Data = data
+		if updated.Annotations == nil {
+			updated.Annotations = make(map[string]string)
+		}
+		updated.Annotations[checksumAnnotation] = checksum
+		fmt.Fprintf(os.Stderr, "\nUpdate ConfigMap \"%s\"\n", name)
+		if _, err := c.clientSet.CoreV1().ConfigMaps(cmnamespace).Update(c.ctx, updated, metav1.UpdateOptions{}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.checksums[name] = checksum
+	}
+	err := errors.Join(errs...)
+	recordConfigMapWrite(err)
+	return err
+}
+
+// internal helper function to compute the SHA-256 checksum of ConfigMap data independent of map order
+func dataChecksum(data map[string]string) string {
+	hash := sha256.New()
+	for _, key := range slices.Sorted(maps.Keys(data)) {
+		fmt.Fprintf(hash, "%s\x00%s\x00", key, data[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// internal function to create an empty ConfigMap, an already existing ConfigMap is overridden on the next update
+func (c *configMapSink) create(name string) (*v1.ConfigMap, error) {
+	cm := &v1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ConfigMap",
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      configmap,
-			Namespace: namespace,
+			Name:      name,
+			Namespace: cmnamespace,
 		},
 	}
-	fmt.Fprintf(os.Stderr, "\nCreate empty ConfigMap \"%s\" in namespace \"%s\"\n", configmap, namespace)
-	fmt.Fprintf(os.Stderr, "First nodeclaim data in ConfigMap \"%s/%s\" in %s (%.0f seconds), type Ctrl-C to end program\n", namespace, configmap, cmupdfreq.String(), cmupdfreq.Seconds())
-	clientSet.CoreV1().ConfigMaps(namespace).Create(ctx, &cm, metav1.CreateOptions{})
-	// update nodeclaim ConfigMap every cmupdfreq seconds
-	for range time.Tick(cmupdfreq) {
-		// get actual data from nodeclaimmap
-		cm.Data = lp4k.ConvertResult(nodeclaimmap)
-		fmt.Fprintf(os.Stderr, "\nUpdate ConfigMap\n")
-		clientSet.CoreV1().ConfigMaps(namespace).Update(ctx, &cm, metav1.UpdateOptions{})
-		fmt.Fprintf(os.Stderr, "Current time: %s\n", time.Now().Format(time.RFC850))
-		if nodeclaimprint {
-			lp4k.PrintSortedResult(nodeclaimmap)
-		}
+	fmt.Fprintf(os.Stderr, "\nCreate empty ConfigMap \"%s\" in namespace \"%s\"\n", name, cmnamespace)
+	if _, err := c.clientSet.CoreV1().ConfigMaps(cmnamespace).Create(c.ctx, cm, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to create ConfigMap \"%s/%s\": %v\n", cmnamespace, name, err)
+		return nil, err
+	}
+	c.cms[name] = cm
+	return cm, nil
+}
+
+// internal helper function to construct a DNS-safe ConfigMap name "<configmap>-<nodepool>"
+func nodepoolConfigMapName(nodepool string) string {
+	suffix := strings.Trim(dnsUnsafePattern.ReplaceAllString(strings.ToLower(nodepool), "-"), "-.")
+	if suffix == "" {
+		suffix = "unknown"
+	}
+	name := fmt.Sprintf("%s-%s", configmap, suffix)
+	// ConfigMap names are DNS subdomains with at most 253 characters
+	return strings.TrimRight(name[:min(len(name), 253)], "-.")
+}
 
-		// upload to S3 if configured
-		if s3.IsEnabled() {
-			if err := s3.UploadToS3(nodeclaimmap); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: Failed to upload to S3: %v\n", err)
+// NewConfigMapSink creates an empty lp4k ConfigMap and returns a sink updating it
+// with LP4K_CM_LAYOUT=nodepool ConfigMaps are created per nodepool on first write instead
+// ConfigMap data has to be map[string]string
+func NewConfigMapSink(ctx context.Context, clientSet kubernetes.Interface) lp4k.Sink {
+	// create ConfigMap in same namespace like Karpenter namespace unless LP4K_CM_NAMESPACE is set
+	if resumefrom != "" {
+		// continue updating the resumed ConfigMap
+		configmap = resumefrom
+	} else if cmoverride {
+		// use unique ConfigMap name and override on every start
+		configmap = configmappref
+	} else {
+		// construct ConfigMap name from time stamp
+		configmap = fmt.Sprintf("%s-%s", configmappref, s3.GetStartTimestamp())
+	}
+	sink := &configMapSink{
+		ctx:       ctx,
+		clientSet: clientSet,
+		cms:       make(map[string]*v1.ConfigMap),
+		checksums: make(map[string]string),
+	}
+	if cmlayout != "nodepool" {
+		_, err := sink.create(configmap)
+		recordConfigMapWrite(err)
+	}
+	return sink
+}
+
+// internal function to collect all sinks of cluster mode, ConfigMap and STDOUT are enabled by default
+func clusterSinks(ctx context.Context, clientSet kubernetes.Interface) []lp4k.Sink {
+	var sinks []lp4k.Sink
+	if lp4k.SinkEnabled("configmap", true) {
+		sinks = append(sinks, NewConfigMapSink(ctx, clientSet))
+	}
+	if lp4k.SinkEnabled("stdout", nodeclaimprint) {
+		sinks = append(sinks, lp4k.StdoutSink{})
+	}
+	if sink := lp4k.NewFileSink(); sink != nil {
+		sinks = append(sinks, sink)
+	}
+	if sink := s3.NewSink(); sink != nil {
+		sinks = append(sinks, sink)
+	}
+	if sink := remotewrite.NewSink(); sink != nil {
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+// internal function to write nodeclaims to all sinks every cmupdfreq seconds
+// sinks get a snapshot of store, so parsing continues while sinks are written
+func nodeclaimsConfigMap(logparser *lp4k.Parser, store *lp4k.Nodeclaimstore, sinks []lp4k.Sink) {
+	fmt.Fprintf(os.Stderr, "\nUsing ConfigMap \"%s\" in namespace \"%s\" with updates every %s\n", configmap, cmnamespace, cmupdfreq.String())
+	fmt.Fprintf(os.Stderr, "First nodeclaim data in ConfigMap \"%s/%s\" in %s (%.0f seconds), type Ctrl-C to end program\n", cmnamespace, configmap, cmupdfreq.String(), cmupdfreq.Seconds())
+	// update sinks every cmupdfreq seconds
+	for range time.Tick(cmupdfreq) {
+		nodeclaimmap := store.Snapshot()
+		// enrich nodeclaims with instance type details if configured
+		if ec2.IsEnabled() {
+			if err := ec2.EnrichInstanceTypes(nodeclaimmap); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to enrich instance types: %v\n", err)
 			}
 		}
+		fmt.Fprintf(os.Stderr, "Current time: %s\n", time.Now().Format(time.RFC850))
+		if breaches := logparser.ReadySLABreaches(); breaches > 0 {
+			fmt.Fprintf(os.Stderr, "Nodeclaims exceeding ready SLA so far: %d\n", breaches)
+		}
+		lp4k.WriteSinks(sinks, nodeclaimmap)
 
-		fmt.Fprintf(os.Stderr, "\nNext nodeclaim data in ConfigMap \"%s/%s\" in %s (%.0f seconds), type Ctrl-C to end program\n", namespace, configmap, cmupdfreq.String(), cmupdfreq.Seconds())
+		fmt.Fprintf(os.Stderr, "\nNext nodeclaim data in ConfigMap \"%s/%s\" in %s (%.0f seconds), type Ctrl-C to end program\n", cmnamespace, configmap, cmupdfreq.String(), cmupdfreq.Seconds())
 	}
 }
 
-func CollectKarpenterLogs(ctx context.Context, clientSet *kubernetes.Clientset, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) {
+// internal function to list Karpenter controller pods, an empty pod list is an error
+func listKarpenterPods(ctx context.Context, clientSet kubernetes.Interface) (*v1.PodList, error) {
 	// get the pods as ListItems
 	fmt.Fprintf(os.Stderr, "\nRetrieving pods from namespace \"%s\" with label \"%s\"\n", namespace, label)
 	pods, err := clientSet.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: label})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get pods: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to get pods: %w", err)
 	}
 	if len(pods.Items) == 0 {
-		fmt.Fprintf(os.Stderr, "\nEmpty pod list - no pods in namespace \"%s\" with label \"%s\" - finishing\n", namespace, label)
-		os.Exit(1)
+		return nil, fmt.Errorf("empty pod list - no pods in namespace \"%s\" with label \"%s\"", namespace, label)
 	}
 	fmt.Fprintf(os.Stderr, "\nFound pods in namespace \"%s\" with label \"%s\"\n", namespace, label)
+	return pods, nil
+}
+
+// internal helper function to trigger the graceful shutdown on ch after LP4K_RUN_FOR or LP4K_MAX_LINES like Ctrl-C
+func stopAfterBudget(logparser *lp4k.Parser, ch chan os.Signal) {
+	stop := func() {
+		select {
+		case ch <- syscall.SIGTERM:
+		default:
+			// shutdown is already pending
+		}
+	}
+	if runfor > 0 {
+		fmt.Fprintf(os.Stderr, "\nStopping after %s\n", runfor)
+		time.AfterFunc(runfor, stop)
+	}
+	go func() {
+		<-logparser.LineBudgetReached()
+		stop()
+	}()
+}
+
+// CheckConnectivity verifies that Karpenter pods can be listed with LP4K_KARPENTER_NAMESPACE and LP4K_KARPENTER_LABEL and that ConfigMaps can be written
+// found pods are printed with phase and age, all failed checks are returned as one error
+func CheckConnectivity(ctx context.Context, clientSet kubernetes.Interface) error {
+	var errs []error
+	if pods, err := listKarpenterPods(ctx, clientSet); err != nil {
+		errs = append(errs, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "Found %d Karpenter pods:\n", len(pods.Items))
+		for _, pod := range pods.Items {
+			fmt.Fprintf(os.Stderr, "  %s\t%s\t%s\n", pod.Name, pod.Status.Phase, time.Since(pod.CreationTimestamp.Time).Round(time.Second))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "\nChecking ConfigMap write access in namespace \"%s\"\n", cmnamespace)
+	if denied, err := deniedConfigMapVerbs(ctx, clientSet); err != nil {
+		errs = append(errs, err)
+	} else if len(denied) > 0 {
+		errs = append(errs, fmt.Errorf("not allowed to %s ConfigMaps in namespace \"%s\"", strings.Join(denied, " and "), cmnamespace))
+	} else {
+		fmt.Fprintf(os.Stderr, "ConfigMaps can be created and updated in namespace \"%s\"\n", cmnamespace)
+	}
+	return errors.Join(errs...)
+}
+
+// internal function to stream and parse the logs of one Karpenter pod once a slot of semaphore is free
+// a failed stream, like of a queued pod which is gone meanwhile, is logged and releases its slot while other streams continue
+func streamPodLogs(ctx context.Context, clientSet kubernetes.Interface, pod v1.Pod, semaphore chan struct{}, logparser *lp4k.Parser, store *lp4k.Nodeclaimstore) {
+	semaphore <- struct{}{}
+	defer func() { <-semaphore }()
+	fmt.Fprintf(os.Stderr, "Streaming logs from pod \"%s\" in namespace \"%s\"\n", pod.Name, pod.Namespace)
+	podLogs, err := clientSet.CoreV1().Pods(namespace).GetLogs(pod.Name, &v1.PodLogOptions{Follow: true}).Stream(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to stream logs from pod \"%s\" - %s\n", pod.Name, err.Error())
+		return
+	}
+	defer podLogs.Close()
+	logparser.SynchronizedParser(bufio.NewScanner(podLogs), store, pod.Name, 0)
+	fmt.Fprintf(os.Stderr, "Finished streaming logs from pod \"%s\"\n", pod.Name)
+}
+
+// CollectKarpenterLogs streams and parses the logs of all Karpenter pods into sinks until Ctrl-C, LP4K_RUN_FOR or LP4K_MAX_LINES
+// all pod log streams are parsed by logparser, errors before streaming started are returned, later errors of single streams or sinks are logged only
+func CollectKarpenterLogs(ctx context.Context, clientSet kubernetes.Interface, logparser *lp4k.Parser, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) error {
+	pods, err := listKarpenterPods(ctx, clientSet)
+	if err != nil {
+		return err
+	}
+	// load nodeclaims of a previous run before any new events are parsed, so they are merged into the loaded state
+	if resumefrom != "" {
+		if err := ReadnodeclaimsConfigMap(ctx, clientSet, resumefrom, nodeclaimmap); err != nil {
+			return err
+		}
+		// restore K8s node names, so node events of resumed nodeclaims are correlated
+		lp4k.Populatek8snodenamemap(nodeclaimmap, k8snodenamemap)
+		fmt.Fprintf(os.Stderr, "Resuming with %d nodeclaims from ConfigMap \"%s\"\n", len(*nodeclaimmap), resumefrom)
+	}
 	// get the pod lists first, then get the podLogs from each of the pods
 	// use channel for blocking reasons
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
-	for i := range pods.Items {
-		fmt.Fprintf(os.Stderr, "Streaming logs from pod \"%s\" in namespace \"%s\"\n", pods.Items[i].Name, pods.Items[i].Namespace)
-		podLogs, err := clientSet.CoreV1().Pods(namespace).GetLogs(pods.Items[i].Name, &v1.PodLogOptions{Follow: true}).Stream(ctx)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to stream pod logs - %s\n", err.Error())
-			os.Exit(1)
+	stopAfterBudget(logparser, ch)
+	// limit concurrent streams to LP4K_MAX_STREAMS, further pods are queued until a stream ends
+	streams := len(pods.Items)
+	if maxstreams > 0 && maxstreams < streams {
+		fmt.Fprintf(os.Stderr, "Streaming at most %d of %d pods concurrently\n", maxstreams, streams)
+		streams = maxstreams
+	}
+	semaphore := make(chan struct{}, streams)
+	// read already existing ConfigMap in override mode only, a resumed ConfigMap has been read already
+	// seeded before pod log streams start, so parsed events are merged into the seeded nodeclaims and never overwritten by them
+	if cmoverride && resumefrom == "" {
+		if err := seedFromConfigMap(ctx, clientSet, nodeclaimmap, k8snodenamemap); err != nil {
+			return err
 		}
-		defer podLogs.Close()
-		go lp4k.NonBlockingParser(bufio.NewScanner(podLogs), nodeclaimmap, k8snodenamemap, "STDIN", 0)
 	}
-	// read already existing ConfigMap in override mode only
-	if cmoverride {
-		ReadnodeclaimsConfigMap(ctx, clientSet, configmappref, nodeclaimmap)
+	// from here on pod log streams, the Event informer and sinks share nodeclaimmap and k8snodenamemap via store only
+	store := lp4k.NewNodeclaimstore(nodeclaimmap, k8snodenamemap)
+	for i := range pods.Items {
+		go streamPodLogs(ctx, clientSet, pods.Items[i], semaphore, logparser, store)
+	}
+	checkConfigMapNamespace(ctx, clientSet)
+	// correlate Karpenter Events onto nodeclaims if enabled
+	if events {
+		stop := make(chan struct{})
+		defer close(stop)
+		watchKarpenterEvents(clientSet, logparser, store, stop)
 	}
-	// create and update ConfigMap with nodeclaims
-	go nodeclaimsConfigMap(ctx, clientSet, nodeclaimmap)
-	// required to block until Ctrl-C
-	defer func() { <-ch }()
+	// create ConfigMap and update all sinks with nodeclaims
+	sinks := clusterSinks(ctx, clientSet)
+	// serve probe and pprof endpoints if configured, readiness depends on the enabled sinks
+	startHealthServer(logparser, sinks)
+	startPprofServer()
+	go nodeclaimsConfigMap(logparser, store, sinks)
+	// required to block until Ctrl-C, write final results to all sinks at shutdown
+	defer func() {
+		<-ch
+		fmt.Fprintf(os.Stderr, "\nWriting final nodeclaim data before shutdown\n")
+		// pod log streams are still running, so write a final snapshot
+		snapshot := store.Snapshot()
+		lp4k.WriteSinks(sinks, snapshot)
+		logparser.PrintSummary(snapshot)
+		logparser.PrintProfile()
+		lp4k.CloseWarnings()
+	}()
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,425 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	fakerest "k8s.io/client-go/rest/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+)
+
+// internal helper function to parse the sample Karpenter log into a nodeclaim map
+func parseSampleInput(t *testing.T) *map[string]lp4k.Nodeclaimstruct {
+	t.Helper()
+	nodeclaimmap := make(map[string]lp4k.Nodeclaimstruct)
+	if err := lp4k.NewParserWithOptions(lp4k.Options{}).ParseFile("../sample-input.txt", &nodeclaimmap, &map[string]string{}); err != nil {
+		t.Fatalf("failed to parse sample input: %v", err)
+	}
+	if len(nodeclaimmap) == 0 {
+		t.Fatalf("no nodeclaims parsed from sample input")
+	}
+	return &nodeclaimmap
+}
+
+func TestConfigMapSinkWrite(t *testing.T) {
+	ctx := context.Background()
+	clientSet := fake.NewSimpleClientset()
+	nodeclaimmap := parseSampleInput(t)
+
+	sink := NewConfigMapSink(ctx, clientSet)
+	if _, err := clientSet.CoreV1().ConfigMaps(cmnamespace).Get(ctx, configmap, metav1.GetOptions{}); err != nil {
+		t.Fatalf("ConfigMap %q not created: %v", configmap, err)
+	}
+	if err := sink.Write(nodeclaimmap); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	cm, err := clientSet.CoreV1().ConfigMaps(cmnamespace).Get(ctx, configmap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("ConfigMap %q not found after Write: %v", configmap, err)
+	}
+	want, _ := lp4k.ConvertResult(nodeclaimmap)
+	if !maps.Equal(cm.Data, want) {
+		t.Errorf("ConfigMap data differs from ConvertResult\ngot:  %v\nwant: %v", cm.Data, want)
+	}
+	if checksum := cm.Annotations[checksumAnnotation]; checksum != dataChecksum(want) {
+		t.Errorf("ConfigMap checksum annotation %q does not match data", checksum)
+	}
+	// unchanged data must not fail
+	if err := sink.Write(nodeclaimmap); err != nil {
+		t.Errorf("second Write failed: %v", err)
+	}
+}
+
+func TestConfigMapSinkWriteRetriesFailedUpdate(t *testing.T) {
+	ctx := context.Background()
+	clientSet := fake.NewSimpleClientset()
+	nodeclaimmap := parseSampleInput(t)
+	var updates int
+	clientSet.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if updates++; updates == 1 {
+			return true, nil, errors.New("injected update failure")
+		}
+		return false, nil, nil
+	})
+
+	sink := NewConfigMapSink(ctx, clientSet)
+	if err := sink.Write(nodeclaimmap); err == nil {
+		t.Fatalf("expected first Write to fail")
+	}
+	// same data again must be retried instead of being skipped as unchanged
+	if err := sink.Write(nodeclaimmap); err != nil {
+		t.Fatalf("second Write failed: %v", err)
+	}
+	if updates != 2 {
+		t.Errorf("expected failed update to be retried, got %d updates", updates)
+	}
+	cm, err := clientSet.CoreV1().ConfigMaps(cmnamespace).Get(ctx, configmap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("ConfigMap %q not found after Write: %v", configmap, err)
+	}
+	if want, _ := lp4k.ConvertResult(nodeclaimmap); !maps.Equal(cm.Data, want) {
+		t.Errorf("ConfigMap data not written after retry")
+	}
+	if err := sink.Write(nodeclaimmap); err != nil || updates != 2 {
+		t.Errorf("expected unchanged data to be skipped after successful update, got %d updates, err %v", updates, err)
+	}
+}
+
+func TestReadnodeclaimsConfigMap(t *testing.T) {
+	ctx := context.Background()
+	nodeclaimmap := parseSampleInput(t)
+	data, _ := lp4k.ConvertResult(nodeclaimmap)
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "lp4k-cm-test", Namespace: cmnamespace},
+		Data:       data,
+	})
+
+	readmap := make(map[string]lp4k.Nodeclaimstruct)
+	if err := ReadnodeclaimsConfigMap(ctx, clientSet, "lp4k-cm-test", &readmap); err != nil {
+		t.Fatalf("ReadnodeclaimsConfigMap failed: %v", err)
+	}
+	if !reflect.DeepEqual(readmap, *nodeclaimmap) {
+		t.Errorf("nodeclaims read from ConfigMap differ from parsed nodeclaims\ngot:  %v\nwant: %v", readmap, *nodeclaimmap)
+	}
+
+	if err := ReadnodeclaimsConfigMap(ctx, clientSet, "does-not-exist", &readmap); err == nil {
+		t.Errorf("expected error for missing ConfigMap")
+	}
+}
+
+func TestReadConfigMaps(t *testing.T) {
+	nodeclaimmap := parseSampleInput(t)
+	data, _ := lp4k.ConvertResult(nodeclaimmap)
+	clientSets := map[string]kubernetes.Interface{
+		"":      fake.NewSimpleClientset(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "lp4k-cm-a", Namespace: cmnamespace}, Data: data}),
+		"other": fake.NewSimpleClientset(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "lp4k-cm-b", Namespace: cmnamespace}, Data: data}),
+	}
+	var connects []string
+	connect := func(kubecontext string, cluster string) (context.Context, kubernetes.Interface, error) {
+		connects = append(connects, kubecontext)
+		if clientSet, ok := clientSets[kubecontext]; ok {
+			return context.Background(), clientSet, nil
+		}
+		return nil, nil, fmt.Errorf("context %q does not exist", kubecontext)
+	}
+
+	// failing connections and ConfigMaps do not stop reading the remaining ConfigMaps
+	readmap := make(map[string]lp4k.Nodeclaimstruct)
+	err := readConfigMaps([]string{"lp4k-cm-a", "missing:lp4k-cm-a", "other:lp4k-cm-missing", "other:lp4k-cm-b"}, "", "", connect, &readmap)
+	if err == nil || !strings.Contains(err.Error(), "missing:lp4k-cm-a, other:lp4k-cm-missing") {
+		t.Errorf("expected error naming both failed ConfigMaps, got %v", err)
+	}
+	if !reflect.DeepEqual(readmap, *nodeclaimmap) {
+		t.Errorf("expected nodeclaims of the read ConfigMaps")
+	}
+	if !reflect.DeepEqual(connects, []string{"", "missing", "other"}) {
+		t.Errorf("expected one connection per context, got %v", connects)
+	}
+	if err := readConfigMaps([]string{"lp4k-cm-a"}, "", "", connect, &readmap); err != nil {
+		t.Errorf("readConfigMaps failed: %v", err)
+	}
+}
+
+func TestDiffnodeclaimsConfigMaps(t *testing.T) {
+	ctx := context.Background()
+	nodeclaimmap := parseSampleInput(t)
+	olddata, _ := lp4k.ConvertResult(nodeclaimmap)
+	name := slices.Sorted(maps.Keys(*nodeclaimmap))[0]
+	nc := (*nodeclaimmap)[name]
+	nc.Nodepool = "changed"
+	(*nodeclaimmap)[name] = nc
+	newdata, _ := lp4k.ConvertResult(nodeclaimmap)
+	clientSet := fake.NewSimpleClientset(
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "lp4k-cm-old", Namespace: cmnamespace}, Data: olddata},
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "lp4k-cm-new", Namespace: cmnamespace}, Data: newdata},
+	)
+	diffs, err := DiffnodeclaimsConfigMaps(ctx, clientSet, "lp4k-cm-old", "lp4k-cm-new")
+	if err != nil {
+		t.Fatalf("DiffnodeclaimsConfigMaps failed: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].Nodeclaim != name || diffs[0].Field != "Nodepool" || diffs[0].New != "changed" {
+		t.Errorf("expected only changed Nodepool of %s, got %+v", name, diffs)
+	}
+	if _, err := DiffnodeclaimsConfigMaps(ctx, clientSet, "lp4k-cm-old", "does-not-exist"); err == nil {
+		t.Errorf("expected error for missing ConfigMap")
+	}
+}
+
+func TestSeedFromConfigMap(t *testing.T) {
+	ctx := context.Background()
+	defer func(d time.Duration) { cmretention = d }(cmretention)
+	cmretention = 0
+	nodeclaimmap := parseSampleInput(t)
+	data, _ := lp4k.ConvertResult(nodeclaimmap)
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: configmappref, Namespace: cmnamespace}, Data: data})
+
+	seeded := make(map[string]lp4k.Nodeclaimstruct)
+	k8snodenamemap := make(map[string]string)
+	if err := seedFromConfigMap(ctx, clientSet, &seeded, &k8snodenamemap); err != nil {
+		t.Fatalf("seedFromConfigMap failed: %v", err)
+	}
+	// a retention of 0 drops all deleted nodeclaims, K8s node names of the seeded ones are restored
+	for name, nc := range *nodeclaimmap {
+		if _, ok := seeded[name]; ok == nc.Deleted {
+			t.Errorf("unexpected seeding of nodeclaim %s with deleted=%v", name, nc.Deleted)
+		}
+		if nc.K8snodename != "" && !nc.Deleted && k8snodenamemap[nc.K8snodename] != name {
+			t.Errorf("expected K8s node name %s of seeded nodeclaim %s restored", nc.K8snodename, name)
+		}
+	}
+
+	if err := seedFromConfigMap(ctx, fake.NewSimpleClientset(), &seeded, &k8snodenamemap); err != nil {
+		t.Errorf("expected missing ConfigMap to start empty, got %v", err)
+	}
+}
+
+func TestListKarpenterPods(t *testing.T) {
+	ctx := context.Background()
+	if _, err := listKarpenterPods(ctx, fake.NewSimpleClientset()); err == nil {
+		t.Errorf("expected error for empty pod list")
+	}
+
+	clientSet := fake.NewSimpleClientset(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "karpenter-0", Namespace: namespace, Labels: map[string]string{"app.kubernetes.io/name": "karpenter"}}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "coredns-0", Namespace: namespace, Labels: map[string]string{"app.kubernetes.io/name": "coredns"}}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "karpenter-1", Namespace: "other", Labels: map[string]string{"app.kubernetes.io/name": "karpenter"}}},
+	)
+	pods, err := listKarpenterPods(ctx, clientSet)
+	if err != nil {
+		t.Fatalf("listKarpenterPods failed: %v", err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Name != "karpenter-0" {
+		t.Errorf("expected only pod karpenter-0, got %d pods", len(pods.Items))
+	}
+}
+
+func TestCollectKarpenterLogs(t *testing.T) {
+	ctx := context.Background()
+	defer func(cm string, d time.Duration, print bool, addr string) {
+		resumefrom, runfor, nodeclaimprint, metricsaddr = cm, d, print, addr
+	}(resumefrom, runfor, nodeclaimprint, metricsaddr)
+	runfor, nodeclaimprint, metricsaddr = 100*time.Millisecond, false, ""
+	nodeclaimmap := make(map[string]lp4k.Nodeclaimstruct)
+	if err := CollectKarpenterLogs(ctx, fake.NewSimpleClientset(), lp4k.NewParserWithOptions(lp4k.Options{}), &nodeclaimmap, &map[string]string{}); err == nil || !strings.Contains(err.Error(), "empty pod list") {
+		t.Errorf("expected empty pod list error, got %v", err)
+	}
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "karpenter-0", Namespace: namespace, Labels: map[string]string{"app.kubernetes.io/name": "karpenter"}}}
+	resumefrom = "lp4k-cm-resume"
+	if err := CollectKarpenterLogs(ctx, fake.NewSimpleClientset(pod), lp4k.NewParserWithOptions(lp4k.Options{}), &nodeclaimmap, &map[string]string{}); err == nil || !strings.Contains(err.Error(), resumefrom) {
+		t.Errorf("expected error for missing resume ConfigMap, got %v", err)
+	}
+
+	// resumed nodeclaims are written to the resumed ConfigMap at shutdown after LP4K_RUN_FOR
+	data, _ := lp4k.ConvertResult(parseSampleInput(t))
+	clientSet := fake.NewSimpleClientset(pod, &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: resumefrom, Namespace: cmnamespace}, Data: data})
+	if err := CollectKarpenterLogs(ctx, clientSet, lp4k.NewParserWithOptions(lp4k.Options{}), &nodeclaimmap, &map[string]string{}); err != nil {
+		t.Fatalf("CollectKarpenterLogs failed: %v", err)
+	}
+	cm, err := clientSet.CoreV1().ConfigMaps(cmnamespace).Get(ctx, resumefrom, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("ConfigMap %q not found after shutdown: %v", resumefrom, err)
+	}
+	if !maps.Equal(cm.Data, data) || cm.Annotations[checksumAnnotation] == "" {
+		t.Errorf("expected resumed nodeclaims written to ConfigMap %q at shutdown", resumefrom)
+	}
+}
+
+// fake clientset whose pod log streams are counted while open and block reading until release is closed
+type blockingLogsClientset struct {
+	*fake.Clientset
+	inflight, peak atomic.Int32
+	entered        chan struct{}
+	release        chan struct{}
+}
+
+type blockingLogsCoreV1 struct {
+	corev1.CoreV1Interface
+	clientSet *blockingLogsClientset
+}
+
+type blockingLogsPods struct {
+	corev1.PodInterface
+	clientSet *blockingLogsClientset
+}
+
+// log stream of blockingLogsClientset, closing it ends the stream in flight
+type blockingLogsBody struct {
+	io.Reader
+	clientSet *blockingLogsClientset
+}
+
+func (c *blockingLogsClientset) CoreV1() corev1.CoreV1Interface {
+	return blockingLogsCoreV1{c.Clientset.CoreV1(), c}
+}
+
+func (c blockingLogsCoreV1) Pods(namespace string) corev1.PodInterface {
+	return blockingLogsPods{c.CoreV1Interface.Pods(namespace), c.clientSet}
+}
+
+func (p blockingLogsPods) GetLogs(name string, opts *v1.PodLogOptions) *rest.Request {
+	client := &fakerest.RESTClient{
+		Client: fakerest.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
+			n := p.clientSet.inflight.Add(1)
+			for peak := p.clientSet.peak.Load(); n > peak && !p.clientSet.peak.CompareAndSwap(peak, n); peak = p.clientSet.peak.Load() {
+			}
+			p.clientSet.entered <- struct{}{}
+			return &http.Response{StatusCode: http.StatusOK, Body: &blockingLogsBody{strings.NewReader("fake logs"), p.clientSet}}, nil
+		}),
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		GroupVersion:         v1.SchemeGroupVersion,
+		VersionedAPIPath:     fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log", namespace, name),
+	}
+	return client.Request()
+}
+
+func (b *blockingLogsBody) Read(p []byte) (int, error) {
+	<-b.clientSet.release
+	return b.Reader.Read(p)
+}
+
+func (b *blockingLogsBody) Close() error {
+	b.clientSet.inflight.Add(-1)
+	return nil
+}
+
+func TestStreamPodLogsQueued(t *testing.T) {
+	ctx := context.Background()
+	clientSet := &blockingLogsClientset{Clientset: fake.NewSimpleClientset(), entered: make(chan struct{}, 5), release: make(chan struct{})}
+	nodeclaimmap := make(map[string]lp4k.Nodeclaimstruct)
+	k8snodenamemap := make(map[string]string)
+	store := lp4k.NewNodeclaimstore(&nodeclaimmap, &k8snodenamemap)
+	// two slots queue all further pods until a previous log stream ended
+	semaphore := make(chan struct{}, 2)
+	logparser := lp4k.NewParserWithOptions(lp4k.Options{})
+	var wg sync.WaitGroup
+	for i := range 5 {
+		wg.Go(func() {
+			streamPodLogs(ctx, clientSet, v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("karpenter-%d", i), Namespace: namespace}}, semaphore, logparser, store)
+		})
+	}
+	<-clientSet.entered
+	<-clientSet.entered
+	select {
+	case <-clientSet.entered:
+		t.Errorf("expected queued stream to wait for a free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(clientSet.release)
+	wg.Wait()
+	if got := clientSet.peak.Load(); got != 2 {
+		t.Errorf("expected 2 concurrent streams at most, got peak %d", got)
+	}
+	if len(semaphore) != 0 {
+		t.Errorf("expected all stream slots to be released, %d still taken", len(semaphore))
+	}
+}
+
+func TestCheckConnectivity(t *testing.T) {
+	ctx := context.Background()
+	if err := CheckConnectivity(ctx, fake.NewSimpleClientset()); err == nil {
+		t.Errorf("expected error without Karpenter pods and ConfigMap access")
+	}
+
+	clientSet := fake.NewSimpleClientset(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "karpenter-0", Namespace: namespace, Labels: map[string]string{"app.kubernetes.io/name": "karpenter"}}},
+	)
+	clientSet.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		review.Status.Allowed = true
+		return true, review, nil
+	})
+	if err := CheckConnectivity(ctx, clientSet); err != nil {
+		t.Errorf("CheckConnectivity failed: %v", err)
+	}
+}
+
+func TestRestConfigInCluster(t *testing.T) {
+	defer func(enabled bool) { incluster = enabled }(incluster)
+	// outside of a pod neither the in-cluster config nor the fallback to it is available
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBECONFIG", t.TempDir()+"/does-not-exist")
+	kubeconfig := ""
+	incluster = true
+	if _, err := restConfig(&kubeconfig, "", ""); err == nil || !strings.Contains(err.Error(), inclusterEnv) {
+		t.Errorf("expected in-cluster config error mentioning %s, got %v", inclusterEnv, err)
+	}
+	incluster = false
+	if _, err := restConfig(&kubeconfig, "", ""); err == nil || !strings.Contains(err.Error(), "Failed to build config") {
+		t.Errorf("expected error without kubeconfig and in-cluster config, got %v", err)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	defer func(last int64) { lastcmwrite.Store(last) }(lastcmwrite.Load())
+	lastcmwrite.Store(time.Now().Add(-3 * cmupdfreq).UnixNano())
+	for _, cmsink := range []bool{true, false} {
+		recorder := httptest.NewRecorder()
+		readyz(cmsink)(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		// without ConfigMap sink a missing ConfigMap write must not turn lp4k unready
+		if want := map[bool]int{true: http.StatusServiceUnavailable, false: http.StatusOK}[cmsink]; recorder.Code != want {
+			t.Errorf("cmsink=%v: expected status %d after missed ConfigMap writes, got %d", cmsink, want, recorder.Code)
+		}
+	}
+	recordConfigMapWrite(nil)
+	recorder := httptest.NewRecorder()
+	readyz(true)(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected ready after successful ConfigMap write, got %d", recorder.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	metrics(lp4k.NewParserWithOptions(lp4k.Options{}))(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"lp4k_configmap_write_failures_consecutive", "lp4k_node_ready_seconds_count", "lp4k_nodeclaims_created_total"} {
+		if !strings.Contains(recorder.Body.String(), "# TYPE "+name) && !strings.Contains(recorder.Body.String(), name+" ") {
+			t.Errorf("metric %s missing in /metrics", name)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+)
+
+const (
+	// environment variables
+	lokiURLEnv    = "LP4K_LOKI_URL"
+	lokiQueryEnv  = "LP4K_LOKI_QUERY"
+	lokiStartEnv  = "LP4K_LOKI_START"
+	lokiEndEnv    = "LP4K_LOKI_END"
+	lokiLimitEnv  = "LP4K_LOKI_LIMIT"
+	lokiTenantEnv = "LP4K_LOKI_TENANT"
+	// timeout of a single query_range request
+	queryTimeout = 60 * time.Second
+)
+
+var lokiURL, lokiQuery, lokiTenant string
+var lokiStart, lokiEnd time.Time
+var lokiLimit int
+var lokiEnabled bool
+
+// query_range response, values are pairs of nanosecond timestamp and log line
+type queryRangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Values [][2]string `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// one log line of any stream of a query_range response
+type entry struct {
+	timestamp int64
+	line      string
+}
+
+// Initialize Loki configuration from environment variables
+func init() {
+	lokiURL = strings.TrimRight(os.Getenv(lokiURLEnv), "/")
+	lokiEnabled = lokiURL != ""
+	if !lokiEnabled {
+		return
+	}
+	lokiQuery = getEnvOrDefault(lokiQueryEnv, `{app_kubernetes_io_name="karpenter"}`)
+	lokiTenant = os.Getenv(lokiTenantEnv)
+	now := time.Now()
+	var err error
+	if lokiEnd, err = parseTime(getEnvOrDefault(lokiEndEnv, "0s"), now); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid environment variable %s - %s\n", lokiEndEnv, err.Error())
+		os.Exit(1)
+	}
+	if lokiStart, err = parseTime(getEnvOrDefault(lokiStartEnv, "1h"), now); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid environment variable %s - %s\n", lokiStartEnv, err.Error())
+		os.Exit(1)
+	}
+	if !lokiStart.Before(lokiEnd) {
+		fmt.Fprintf(os.Stderr, "Invalid environment variables %s and %s, start must be before end\n", lokiStartEnv, lokiEndEnv)
+		os.Exit(1)
+	}
+	if lokiLimit, err = strconv.Atoi(getEnvOrDefault(lokiLimitEnv, "5000")); err != nil || lokiLimit <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid environment variable %s, must be a positive number of lines per request\n", lokiLimitEnv)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Loki input enabled: url=%s, query=%s, start=%s, end=%s\n", lokiURL, lokiQuery, lokiStart.Format(time.RFC3339), lokiEnd.Format(time.RFC3339))
+}
+
+func getEnvOrDefault(key, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return defaultVal
+}
+
+// internal helper function to parse a RFC3339 time or a duration like "24h" relative to now
+func parseTime(val string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(val); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("\"%s\" must be a RFC3339 time like \"2025-04-24T05:00:00Z\" or a duration before now like \"24h\"", val)
+	}
+	return t, nil
+}
+
+// IsEnabled returns whether Loki is configured as input via LP4K_LOKI_URL
+func IsEnabled() bool {
+	return lokiEnabled
+}
+
+// ParseLoki runs LP4K_LOKI_QUERY against the Loki query_range API for the configured time range and parses all returned log lines
+// the range is paged forward in chunks of LP4K_LOKI_LIMIT lines, lines of all streams are parsed by logparser in timestamp order
+func ParseLoki(logparser *lp4k.Parser, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) error {
+	start := lokiStart.UnixNano()
+	end := lokiEnd.UnixNano()
+	var inputline int
+	for {
+		entries, err := queryRange(start, end)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			inputline++
+			logparser.ParseKarpenterLogs(e.line, nodeclaimmap, k8snodenamemap, "loki", inputline)
+		}
+		// a page with less lines than the limit is the last one
+		if len(entries) < lokiLimit {
+			fmt.Fprintf(os.Stderr, "Parsed %d lines from Loki\n", inputline)
+			return nil
+		}
+		// continue after the last returned line, Loki's start is inclusive
+		start = entries[len(entries)-1].timestamp + 1
+	}
+}
+
+// internal function to fetch one page of log lines between start (inclusive) and end (exclusive) in nanoseconds
+func queryRange(start int64, end int64) ([]entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	params := url.Values{}
+	params.Set("query", lokiQuery)
+	params.Set("start", strconv.FormatInt(start, 10))
+	params.Set("end", strconv.FormatInt(end, 10))
+	params.Set("limit", strconv.Itoa(lokiLimit))
+	params.Set("direction", "forward")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/loki/api/v1/query_range?%s", lokiURL, params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	if lokiTenant != "" {
+		req.Header.Set("X-Scope-OrgID", lokiTenant)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Loki: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to query Loki: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	// decode from the stream, responses are usually sent chunked
+	var result queryRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode Loki response: %w", err)
+	}
+	if result.Status != "success" || result.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("unexpected Loki response with status \"%s\" and result type \"%s\", LP4K_LOKI_QUERY must be a log query", result.Status, result.Data.ResultType)
+	}
+	var entries []entry
+	for _, stream := range result.Data.Result {
+		for _, value := range stream.Values {
+			timestamp, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode Loki timestamp \"%s\": %w", value[0], err)
+			}
+			entries = append(entries, entry{timestamp, value[1]})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].timestamp < entries[j].timestamp })
+	return entries, nil
+}
@@ -4,25 +4,56 @@ package main
 
 import (
 	"bufio"
+	"compress/gzip"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	termutil "github.com/andrew-d/go-termutil"
+	"github.com/awslabs/LogParserForKarpenter/ec2"
 	"github.com/awslabs/LogParserForKarpenter/k8s"
+	"github.com/awslabs/LogParserForKarpenter/loki"
 	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+	"github.com/awslabs/LogParserForKarpenter/remotewrite"
 	"github.com/awslabs/LogParserForKarpenter/s3"
-
-	"k8s.io/client-go/util/homedir"
 )
 
+// output flags shared by the implicit mode and all subcommands printing results
+var limit, latest int
+var provisioningdecisions, histogram, bynode, histogramchart, stuckdisruptions, count, gantt, capacityratio, byzone, top, funnel bool
+var histogrambuckets string
+var providerid, k8snode string
+var htmlfile string
+var source bool
+
+// kubeconfig flags shared by the implicit mode and all subcommands connecting to K8s
+var kubeconfig, kubecontext, cluster string
+
+// lp4k ConfigMap to resume streaming from
+var resumefrom string
+
+var buckets []time.Duration
+
+const usage = `Usage:
+  lp4k [flags] [<Karpenter log file> ...]   parse log files, STDIN or stream from K8s cluster depending on input
+  lp4k parse [flags] [<Karpenter log file> ...]   parse log files or STDIN if no file is given or a file is "-"
+  lp4k stream [flags]   stream and parse Karpenter controller logs from K8s cluster into ConfigMap
+  lp4k cm [flags] [<context>:]<lp4k ConfigMap name> ...   print nodeclaims of lp4k ConfigMaps like lp4kcm
+  lp4k report [flags] <Karpenter log file> ...   print a report of log files instead of nodeclaims
+  lp4k loki [flags]   parse Karpenter logs of a Loki query configured via LP4K_LOKI_URL
+  lp4k check [flags]   check connectivity to K8s cluster, Karpenter pods and ConfigMap write access
+
+Flags:
+`
+
 func main() {
-	var filename string = "STDIN"
 	var nodeclaimmap *map[string]lp4k.Nodeclaimstruct
 	// helper map of k8snodename to nodeclaim
 	var k8snodenamemap *map[string]string
@@ -33,72 +64,407 @@ func main() {
 	nodeclaimmap = &nodeclaimes
 	k8snodenames := make(map[string]string)
 	k8snodenamemap = &k8snodenames
+	// parsing state like cluster events and metrics shared by all inputs
+	logparser := lp4k.NewParser()
 
-	// if we only have CMD itself i.e. len(os.Args) == 1 we assume we get piped input and we check for STDIN
-	if len(os.Args) == 1 {
-		if termutil.Isatty(os.Stdin.Fd()) {
-			fmt.Fprintf(os.Stderr, "Nothing on STDIN - trying to connect to kube-apiserver\n\n")
-			// parse the .kubeconfig file
-			var kubeconfig *string
-			if home := homedir.HomeDir(); home != "" {
-				kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+	// dispatch subcommands, each with its own flag set
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "parse":
+			fs := newFlagSet("parse", "[flags] [<Karpenter log file> ...]", true, false)
+			fs.Parse(os.Args[2:])
+			validateFlags(logparser)
+			if fs.NArg() == 0 {
+				parseStdin(logparser, nodeclaimmap, k8snodenamemap)
 			} else {
-				kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+				parseFiles(logparser, fs.Args(), nodeclaimmap, k8snodenamemap)
+			}
+			printResult(logparser, nodeclaimmap, k8snodenamemap)
+			return
+		case "stream":
+			fs := newFlagSet("stream", "[flags]", false, true)
+			addStreamFlags(fs)
+			fs.Parse(os.Args[2:])
+			streamFromK8s(logparser, nodeclaimmap, k8snodenamemap)
+			return
+		case "cm":
+			fs := newFlagSet("cm", "[flags] [<context>:]<lp4k ConfigMap name> ...", true, true)
+			watch := fs.Bool("watch", false, "watch a single ConfigMap and print its nodeclaims on every change until Ctrl-C")
+			diff := fs.Bool("diff", false, "print only changed fields of nodeclaims present in both of two ConfigMaps")
+			diffformat := fs.String("diff-format", "csv", "output format of -diff, \"csv\" or \"json\"")
+			fs.Parse(os.Args[2:])
+			validateFlags(logparser)
+			if fs.NArg() == 0 {
+				fs.Usage()
+				os.Exit(1)
+			}
+			if *watch || *diff {
+				watchOrDiffConfigMaps(fs.Args(), *watch, *diffformat)
+				return
+			}
+			// print the merged nodeclaims of all read ConfigMaps and exit non-zero afterwards if any failed
+			err := readConfigMaps(fs.Args(), nodeclaimmap, k8snodenamemap)
+			printResult(logparser, nodeclaimmap, k8snodenamemap)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%s\n", err.Error())
+				os.Exit(1)
+			}
+			return
+		case "loki":
+			fs := newFlagSet("loki", "[flags]", true, false)
+			fs.Parse(os.Args[2:])
+			validateFlags(logparser)
+			parseLoki(logparser, nodeclaimmap, k8snodenamemap)
+			printResult(logparser, nodeclaimmap, k8snodenamemap)
+			return
+		case "check":
+			fs := newFlagSet("check", "[flags]", false, true)
+			fs.Parse(os.Args[2:])
+			ctx, clientSet := k8s.ConnectToK8s(&kubeconfig, kubecontext, cluster)
+			if err := k8s.CheckConnectivity(ctx, clientSet); err != nil {
+				fmt.Fprintf(os.Stderr, "\nCheck failed:\n%s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "\nCheck succeeded\n")
+			return
+		case "report":
+			fs := newFlagSet("report", "[flags] <Karpenter log file> ...", true, false)
+			reporttype := fs.String("type", "histogram", "report to print: \"histogram\", \"provisioning-decisions\", \"by-node\", \"stuck-disruptions\", \"count\", \"capacity-ratio\", \"top\" or \"funnel\"")
+			fs.Parse(os.Args[2:])
+			switch *reporttype {
+			case "histogram":
+				histogram = true
+			case "provisioning-decisions":
+				provisioningdecisions = true
+			case "by-node":
+				bynode = true
+			case "stuck-disruptions":
+				stuckdisruptions = true
+			case "count":
+				count = true
+			case "capacity-ratio":
+				capacityratio = true
+			case "top":
+				top = true
+			case "funnel":
+				funnel = true
+			default:
+				fmt.Fprintf(os.Stderr, "Invalid flag -type \"%s\", must be \"histogram\", \"provisioning-decisions\", \"by-node\", \"stuck-disruptions\", \"count\", \"capacity-ratio\", \"top\" or \"funnel\"\n", *reporttype)
+				os.Exit(1)
 			}
-			flag.Parse()
+			validateFlags(logparser)
+			if fs.NArg() == 0 {
+				fs.Usage()
+				os.Exit(1)
+			}
+			parseFiles(logparser, fs.Args(), nodeclaimmap, k8snodenamemap)
+			printResult(logparser, nodeclaimmap, k8snodenamemap)
+			return
+		}
+	}
 
-			ctx, clientSet := k8s.ConnectToK8s(kubeconfig)
+	// no subcommand - keep implicit behavior depending on arguments and STDIN
+	addOutputFlags(flag.CommandLine)
+	addK8sFlags(flag.CommandLine)
+	addStreamFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	validateFlags(logparser)
 
-			// collect and parse logs
-			k8s.CollectKarpenterLogs(ctx, clientSet, nodeclaimmap, k8snodenamemap)
+	// if we only have CMD itself and flags i.e. flag.NArg() == 0 we assume we get piped input and we check for STDIN
+	if flag.NArg() == 0 {
+		if termutil.Isatty(os.Stdin.Fd()) && loki.IsEnabled() {
+			parseLoki(logparser, nodeclaimmap, k8snodenamemap)
+			printResult(logparser, nodeclaimmap, k8snodenamemap)
+		} else if termutil.Isatty(os.Stdin.Fd()) {
+			fmt.Fprintf(os.Stderr, "Nothing on STDIN - trying to connect to kube-apiserver\n\n")
+			streamFromK8s(logparser, nodeclaimmap, k8snodenamemap)
 		} else {
-			fmt.Fprintf(os.Stderr, "Attached to STDIN - parsing iput until EOF or Ctrl-C\n")
-			time.Sleep(1 * time.Second)
+			parseStdin(logparser, nodeclaimmap, k8snodenamemap)
+			printResult(logparser, nodeclaimmap, k8snodenamemap)
+		}
+	} else {
+		parseFiles(logparser, flag.Args(), nodeclaimmap, k8snodenamemap)
+		printResult(logparser, nodeclaimmap, k8snodenamemap)
+	}
+}
 
-			ch := make(chan os.Signal, 1)
-			signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+// create flag set of a subcommand with output and/or kubeconfig flags
+func newFlagSet(name string, args string, output bool, k8sflags bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	if output {
+		addOutputFlags(fs)
+	}
+	if k8sflags {
+		addK8sFlags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  lp4k %s %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-			// main parsing logic
-			lp4k.BlockingParser(ch, bufio.NewScanner(os.Stdin), nodeclaimmap, k8snodenamemap, filename, 0)
+// register flags controlling the printed result
+func addOutputFlags(fs *flag.FlagSet) {
+	fs.IntVar(&limit, "limit", 0, "maximum number of nodeclaims printed after sorting, 0 means unlimited")
+	fs.IntVar(&latest, "latest", 0, "only output the given number of most recently created nodeclaims, 0 means all")
+	fs.BoolVar(&provisioningdecisions, "provisioning-decisions", false, "print Karpenter provisioning decisions with their created nodeclaims instead of nodeclaims")
+	fs.BoolVar(&histogram, "histogram", false, "print distribution of node ready times as bucket counts instead of nodeclaims")
+	fs.StringVar(&histogrambuckets, "histogram-buckets", "30s,60s,90s,120s,180s,300s", "comma separated upper bounds of node ready time histogram buckets")
+	fs.BoolVar(&stuckdisruptions, "stuck-disruptions", false, "print nodeclaims which entered disruption but were never deleted instead of nodeclaims")
+	fs.BoolVar(&count, "count", false, "print only the number of nodeclaims and the number per lifecycle stage instead of nodeclaims")
+	fs.BoolVar(&bynode, "by-node", false, "print nodeclaims keyed and sorted by K8s node name, omitting nodeclaims without node")
+	fs.BoolVar(&capacityratio, "capacity-ratio", false, "print number of launched spot and on-demand nodeclaims and spot percentage per nodepool as CSV instead of nodeclaims")
+	fs.BoolVar(&byzone, "by-zone", false, "split -capacity-ratio per zone")
+	fs.BoolVar(&top, "top", false, "print the 10 (or -limit) slowest to become ready and longest-lived nodeclaims as two tables instead of nodeclaims")
+	fs.BoolVar(&funnel, "funnel", false, "print how many created nodeclaims launched, registered, initialized and were deleted with conversion percentages as CSV instead of nodeclaims")
+	fs.BoolVar(&gantt, "gantt", false, "print nodeclaim lifecycles as Mermaid gantt diagram instead of nodeclaims")
+	fs.BoolVar(&histogramchart, "histogram-chart", false, "print node ready time histogram as text bar chart instead of CSV")
+	fs.StringVar(&providerid, "providerid", "", "only output nodeclaims with this provider ID or EC2 instance ID")
+	fs.StringVar(&k8snode, "k8snode", "", "only output nodeclaims with this K8s node name")
+	fs.BoolVar(&source, "source", false, "record input file and line where each nodeclaim was created as Sourcefile and Sourceline")
+	fs.StringVar(&htmlfile, "html", "", "additionally write a self-contained HTML report with sortable nodeclaim table and charts to this file")
+}
 
-			// STDIN empty or Ctrl-C
-			fmt.Fprintf(os.Stderr, "Finished parsing STDIN\n\n")
+// register flags selecting kubeconfig, context and cluster
+func addK8sFlags(fs *flag.FlagSet) {
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "(optional) absolute path to the kubeconfig file, defaults to KUBECONFIG or ~/.kube/config")
+	fs.StringVar(&kubecontext, "context", "", "(optional) name of the kubeconfig context to use instead of the current context")
+	fs.StringVar(&cluster, "cluster", "", "(optional) name of the kubeconfig cluster to use instead of the cluster of the context")
+}
 
-			// print nodeclaim output to STDOUT
-			lp4k.PrintSortedResult(nodeclaimmap)
+// register flags of streaming from K8s cluster
+func addStreamFlags(fs *flag.FlagSet) {
+	fs.StringVar(&resumefrom, "resume-from", "", "(optional) name of an lp4k ConfigMap to load nodeclaims from before streaming, which is then updated with new events instead of creating a new ConfigMap")
+}
 
-			// upload to S3 if configured
-			if s3.IsEnabled() {
-				if err := s3.UploadToS3(nodeclaimmap); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: Failed to upload to S3: %v\n", err)
-				}
-			}
+// validate flags before parsing any input and apply them to logparser
+func validateFlags(logparser *lp4k.Parser) {
+	if limit < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid flag -limit %d, must not be negative\n", limit)
+		os.Exit(1)
+	}
+	lp4k.SetLimit(limit)
+	if latest < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid flag -latest %d, must not be negative\n", latest)
+		os.Exit(1)
+	}
+	lp4k.SetLatest(latest)
+	logparser.SetRecordSource(source)
+	if histogram || htmlfile != "" {
+		var err error
+		if buckets, err = lp4k.ParseHistogramBuckets(histogrambuckets); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid flag -histogram-buckets \"%s\" - %s\n", histogrambuckets, err.Error())
+			os.Exit(1)
 		}
-	} else {
-		for _, arg := range os.Args[1:] {
-			filename = arg
+	}
+}
 
-			fmt.Fprintf(os.Stderr, "Parsing input file %s\n", filename)
+// connect to K8s cluster and stream Karpenter controller logs into ConfigMap until Ctrl-C
+func streamFromK8s(logparser *lp4k.Parser, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) {
+	ctx, clientSet := k8s.ConnectToK8s(&kubeconfig, kubecontext, cluster)
+	k8s.SetResumeFrom(resumefrom)
 
-			file, err := os.Open(filename)
-			if err != nil {
-				log.Fatal(err)
-			}
-			defer file.Close()
+	// collect and parse logs
+	if err := k8s.CollectKarpenterLogs(ctx, clientSet, logparser, nodeclaimmap, k8snodenamemap); err != nil {
+		fmt.Fprintf(os.Stderr, "%s - finishing\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// parse all log lines of the Loki query configured via LP4K_LOKI_URL
+func parseLoki(logparser *lp4k.Parser, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) {
+	if !loki.IsEnabled() {
+		fmt.Fprintf(os.Stderr, "Loki input requires environment variable LP4K_LOKI_URL\n")
+		os.Exit(1)
+	}
+	if err := loki.ParseLoki(logparser, nodeclaimmap, k8snodenamemap); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// parse STDIN until EOF or Ctrl-C
+func parseStdin(logparser *lp4k.Parser, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) {
+	fmt.Fprintf(os.Stderr, "Attached to STDIN - parsing iput until EOF or Ctrl-C\n")
+	time.Sleep(1 * time.Second)
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 
-			// main parsing logic
-			lp4k.NonBlockingParser(bufio.NewScanner(file), nodeclaimmap, k8snodenamemap, filename, 0)
+	// main parsing logic
+	logparser.BlockingParser(ch, bufio.NewScanner(decompressReader(os.Stdin)), nodeclaimmap, k8snodenamemap, "STDIN", 0)
 
-			fmt.Fprintf(os.Stderr, "Finished parsing input file %s\n\n", filename)
+	// STDIN empty or Ctrl-C
+	fmt.Fprintf(os.Stderr, "Finished parsing STDIN\n\n")
+}
+
+// parse all Karpenter log files in given order, a "-" argument parses STDIN after all files
+func parseFiles(logparser *lp4k.Parser, filenames []string, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) {
+	var stdin bool
+	for _, filename := range expandGlobs(filenames) {
+		if filename == "-" {
+			stdin = true
+			continue
 		}
-		// print nodeclaim output to STDOUT
-		lp4k.PrintSortedResult(nodeclaimmap)
+		fmt.Fprintf(os.Stderr, "Parsing input file %s\n", filename)
 
-		// upload to S3 if configured
-		if s3.IsEnabled() {
-			if err := s3.UploadToS3(nodeclaimmap); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: Failed to upload to S3: %v\n", err)
-			}
+		// main parsing logic
+		if err := logparser.ParseFile(filename, nodeclaimmap, k8snodenamemap); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Finished parsing input file %s\n\n", filename)
+	}
+	if stdin {
+		parseStdin(logparser, nodeclaimmap, k8snodenamemap)
+	}
+}
+
+// expand glob patterns like 'karpenter-*.log' which were not expanded by the shell, arguments without pattern characters are kept as is
+// patterns matching no file are reported and skipped
+func expandGlobs(args []string) []string {
+	var filenames []string
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			filenames = append(filenames, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid file pattern \"%s\" - %s\n", arg, err.Error())
+			os.Exit(1)
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: File pattern \"%s\" matches no files\n", arg)
+		}
+		filenames = append(filenames, matches...)
+	}
+	if len(filenames) == 0 {
+		fmt.Fprintf(os.Stderr, "No input files - finishing\n")
+		os.Exit(1)
+	}
+	return filenames
+}
+
+// read nodeclaims of all given lp4k ConfigMaps like lp4kcm and derive K8s node names from them
+// failed ConfigMaps are returned as error after all others have been read
+func readConfigMaps(cmargs []string, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) error {
+	err := k8s.ReadnodeclaimsConfigMaps(&kubeconfig, kubecontext, cluster, cmargs, nodeclaimmap)
+	lp4k.Populatek8snodenamemap(nodeclaimmap, k8snodenamemap)
+	fmt.Fprintf(os.Stderr, "\n")
+	return err
+}
+
+// watch a single lp4k ConfigMap or print the changed fields between two lp4k ConfigMaps like lp4kcm -watch and -diff
+func watchOrDiffConfigMaps(cmnames []string, watch bool, diffformat string) {
+	if watch && len(cmnames) != 1 {
+		fmt.Fprintf(os.Stderr, "Flag -watch requires exactly one ConfigMap name\n")
+		os.Exit(1)
+	}
+	if !watch && len(cmnames) != 2 {
+		fmt.Fprintf(os.Stderr, "Flag -diff requires exactly two ConfigMap names\n")
+		os.Exit(1)
+	}
+	if diffformat != "csv" && diffformat != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid flag -diff-format \"%s\", must be \"csv\" or \"json\"\n", diffformat)
+		os.Exit(1)
+	}
+	ctx, clientSet := k8s.ConnectToK8s(&kubeconfig, kubecontext, cluster)
+	if watch {
+		k8s.WatchnodeclaimsConfigMap(ctx, clientSet, cmnames[0], lp4k.PrintSortedResult)
+		return
+	}
+	diffs, err := k8s.DiffnodeclaimsConfigMaps(ctx, clientSet, cmnames[0], cmnames[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+	lp4k.PrintDiff(diffs, diffformat)
+}
+
+// print nodeclaim output or requested report to STDOUT and write all other configured sinks
+func printResult(logparser *lp4k.Parser, nodeclaimmap *map[string]lp4k.Nodeclaimstruct, k8snodenamemap *map[string]string) {
+	// enrich nodeclaims with instance type details if configured
+	if ec2.IsEnabled() {
+		if err := ec2.EnrichInstanceTypes(nodeclaimmap); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to enrich instance types: %v\n", err)
+		}
+	}
+
+	// restrict output to a single instance or node if requested and drop short-lived nodeclaims
+	lp4k.FilterNodeclaims(nodeclaimmap, providerid, k8snode)
+
+	// reports replace nodeclaim output on STDOUT, all other sinks are written regardless
+	var sinks []lp4k.Sink
+	if count {
+		lp4k.PrintCount(nodeclaimmap)
+	} else if histogram {
+		lp4k.PrintHistogram(nodeclaimmap, buckets, histogramchart)
+	} else if bynode {
+		lp4k.PrintNodeResult(nodeclaimmap, k8snodenamemap)
+	} else if provisioningdecisions {
+		logparser.PrintProvisioningDecisions()
+	} else if stuckdisruptions {
+		lp4k.PrintStuckDisruptions(nodeclaimmap)
+	} else if capacityratio {
+		lp4k.PrintCapacityRatio(nodeclaimmap, byzone)
+	} else if top {
+		// -limit changes the number of nodeclaims per table, the general limit does not apply
+		n := 10
+		if limit > 0 {
+			n = limit
+		}
+		lp4k.PrintTop(nodeclaimmap, n)
+	} else if funnel {
+		lp4k.PrintFunnel(nodeclaimmap)
+	} else if gantt {
+		fmt.Print(lp4k.ConvertToGantt(nodeclaimmap))
+	} else if lp4k.SinkEnabled("stdout", true) {
+		sinks = append(sinks, lp4k.StdoutSink{})
+	}
+	if sink := lp4k.NewFileSink(); sink != nil {
+		sinks = append(sinks, sink)
+	}
+	// ConfigMap is only written outside of cluster mode if requested explicitly via LP4K_SINKS
+	if lp4k.SinkEnabled("configmap", false) {
+		ctx, clientSet := k8s.ConnectToK8s(&kubeconfig, kubecontext, cluster)
+		sinks = append(sinks, k8s.NewConfigMapSink(ctx, clientSet))
+	}
+	if sink := s3.NewSink(); sink != nil {
+		sinks = append(sinks, sink)
+	}
+	if sink := remotewrite.NewSink(); sink != nil {
+		sinks = append(sinks, sink)
+	}
+	lp4k.WriteSinks(sinks, nodeclaimmap)
+	if htmlfile != "" {
+		if err := lp4k.WriteHTMLReport(nodeclaimmap, buckets, htmlfile); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to write HTML report \"%s\": %v\n", htmlfile, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "\nHTML report written to \"%s\"\n", htmlfile)
+		}
+	}
+	logparser.PrintSummary(nodeclaimmap)
+	logparser.PrintProfile()
+	lp4k.CloseWarnings()
+}
+
+// wrap input in a gzip reader if it starts with the gzip magic bytes, otherwise read it as plain text
+func decompressReader(input io.Reader) io.Reader {
+	reader := bufio.NewReader(input)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipreader, err := gzip.NewReader(reader)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read gzip compressed input: %v\n", err)
+			os.Exit(1)
 		}
+		fmt.Fprintf(os.Stderr, "Detected gzip compressed input\n")
+		return gzipreader
 	}
+	return reader
 }
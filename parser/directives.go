@@ -0,0 +1,83 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// environment variable
+	formatdirectivesEnv = "LP4K_FORMAT_DIRECTIVES"
+	// leading directive lines of an input file
+	formatDirective  = "#lp4k-format:"
+	versionDirective = "#karpenter-version:"
+)
+
+// parsing hints of the input file being parsed by a Parser, set by directives and reset after every file
+// input files are parsed one after another, so the hints of one file never apply to another
+type formathints struct {
+	// "json" for plain Karpenter JSON loglines without journald detection, "journald" to unwrap every logline, empty means auto-detection
+	format string
+	// Karpenter major and minor version selecting one layout per message instead of matching all known layouts, nil means all layouts
+	version []int
+}
+
+// minimum Karpenter version of each layout of disruptingPatterns and taintedPatterns, most recent first
+var (
+	disruptingSince = [][]int{{1, 1}, {0, 0}}
+	taintedSince    = [][]int{{1, 1}, {1, 0}, {0, 0}}
+)
+
+// internal helper function to determine opt-in of directives via OS environment
+func init() {
+	envoptions.Formatdirectives, _ = strconv.ParseBool(os.Getenv(formatdirectivesEnv))
+}
+
+// internal helper function to apply a leading directive line of an input file to hints, returns false if logline is no directive
+func (p *Parser) parseDirective(logline string, inputline int, filename string) bool {
+	var value string
+	switch {
+	case strings.HasPrefix(logline, formatDirective):
+		value = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(logline, formatDirective)))
+		if value != "json" && value != "journald" {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid directive \"%s\" in line %d in %s, must be \"json\" or \"journald\" - using auto-detection\n", logline, inputline, filename)
+			logWarning(slog.LevelWarn, formatDirective, "invalid directive", logline, inputline, filename)
+			return true
+		}
+		p.hints.format = value
+	case strings.HasPrefix(logline, versionDirective):
+		value = strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(logline, versionDirective)), "v")
+		major, minor, _ := strings.Cut(value, ".")
+		minor, _, _ = strings.Cut(minor, ".")
+		majornum, err1 := strconv.Atoi(major)
+		minornum, err2 := strconv.Atoi(minor)
+		if err1 != nil || err2 != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid directive \"%s\" in line %d in %s, must be a Karpenter version like \"1.1\" - matching all known layouts\n", logline, inputline, filename)
+			logWarning(slog.LevelWarn, versionDirective, "invalid directive", logline, inputline, filename)
+			return true
+		}
+		p.hints.version = []int{majornum, minornum}
+	default:
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Applying directive \"%s\" to %s\n", logline, filename)
+	return true
+}
+
+// internal helper function to return the index of the layout used by the Karpenter version of hints, -1 if there is no version hint
+func (hints formathints) hintedLayout(since [][]int) int {
+	if hints.version == nil {
+		return -1
+	}
+	for i, version := range since {
+		if hints.version[0] > version[0] || (hints.version[0] == version[0] && hints.version[1] >= version[1]) {
+			return i
+		}
+	}
+	return len(since) - 1
+}
@@ -0,0 +1,195 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	provisionablePattern = regexp.MustCompile(`"time":"(.*)","logger".*"reconcileID":"(.*)","Pods":"(.*)","duration"`)
+	computedPattern      = regexp.MustCompile(`"time":"(.*)","logger".*"reconcileID":"(.*)","nodeclaims":(.*),"pods":(.*)}`)
+	reconcileIDPattern   = regexp.MustCompile(`"reconcileID":"([^"]*)"`)
+	restartPattern       = regexp.MustCompile(`"time":"([^"]*)","logger"`)
+	nodepoolNamePattern  = regexp.MustCompile(`"NodePool":{"name":"([^"]*)"}`)
+	blockReasonPattern   = regexp.MustCompile(`"reason":"([^"]*)"`)
+)
+
+// cluster-level provisioning decision of Karpenter's provisioner i.e. one "computed new nodeclaim(s) to fit pod(s)" log line
+// keep counts as strings like in Nodeclaimstruct
+type Provisioningdecision struct {
+	Time           string
+	Reconcileid    string
+	Nodeclaimcount string
+	Podcount       string
+	Nodeclaims     string
+	Pods           string
+}
+
+// cluster-level disruption of a nodepool blocked by disruption budgets, PDBs or do-not-disrupt pods
+// Reason is the "reason" of the log line if present, else the Karpenter log message
+type Disruptionblock struct {
+	Time     string
+	Nodepool string
+	Reason   string
+}
+
+// cluster-level event log of a Parser, guarded by mutex because pod log streams are parsed concurrently
+type clusterevents struct {
+	mutex                 sync.Mutex
+	provisioningdecisions []Provisioningdecision
+	// start times of Karpenter controller in log order
+	restarts []string
+	// blocked disruptions in log order
+	disruptionblocks []Disruptionblock
+	// pods of "found provisionable pod(s)" by reconcileID until the corresponding decision is logged
+	provisionablepods map[string]string
+}
+
+// internal helper function to parse cluster-level provisioning messages, returns false if logline did not match
+func (e *clusterevents) parseProvisioningEvent(message string, logline string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	switch message {
+	case "found provisionable pod(s)":
+		// extract reconcileID and triggering pods
+		if matchslicesub := matchPattern(provisionablePattern, logline); matchslicesub != nil {
+			e.provisionablepods[matchslicesub[2]] = pipeList(matchslicesub[3])
+			return true
+		}
+	case "computed new nodeclaim(s) to fit pod(s)":
+		// extract time, reconcileID, number of nodeclaims and pods
+		if matchslicesub := matchPattern(computedPattern, logline); matchslicesub != nil {
+			e.provisioningdecisions = append(e.provisioningdecisions, Provisioningdecision{
+				Time:           matchslicesub[1],
+				Reconcileid:    matchslicesub[2],
+				Nodeclaimcount: matchslicesub[3],
+				Podcount:       matchslicesub[4],
+				Pods:           e.provisionablepods[matchslicesub[2]],
+			})
+			delete(e.provisionablepods, matchslicesub[2])
+			return true
+		}
+	}
+	return false
+}
+
+// internal helper function to correlate a created nodeclaim with the provisioning decision of the same reconcileID
+func (e *clusterevents) correlateProvisioningDecision(nodeclaim string, logline string) {
+	matchslicesub := matchPattern(reconcileIDPattern, logline)
+	if matchslicesub == nil {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	// search backwards because the decision is logged right before its "created nodeclaim" lines
+	for i := len(e.provisioningdecisions) - 1; i >= 0; i-- {
+		if e.provisioningdecisions[i].Reconcileid == matchslicesub[1] {
+			if e.provisioningdecisions[i].Nodeclaims == "" {
+				e.provisioningdecisions[i].Nodeclaims = nodeclaim
+			} else {
+				e.provisioningdecisions[i].Nodeclaims = fmt.Sprintf("%s|%s", e.provisioningdecisions[i].Nodeclaims, nodeclaim)
+			}
+			return
+		}
+	}
+}
+
+// internal helper function to record a Karpenter controller start
+func (e *clusterevents) recordRestart(starttime string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.restarts = append(e.restarts, starttime)
+}
+
+// internal helper function to check if a Karpenter log message reports disruption blocked by budgets, PDBs or do-not-disrupt pods
+// wording differs between Karpenter versions like "disruption blocked by budget" or "no allowed disruptions due to blocking budget"
+func isDisruptionBlocked(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "block") && (strings.Contains(message, "budget") || strings.Contains(message, "pdb") || strings.Contains(message, "do-not-disrupt"))
+}
+
+// internal helper function to record a blocked disruption with time, nodepool and reason of logline
+func (e *clusterevents) recordDisruptionBlock(message string, logline string) Disruptionblock {
+	block := Disruptionblock{Reason: message}
+	if matchslicesub := matchPattern(timePattern, logline); matchslicesub != nil {
+		block.Time = matchslicesub[1]
+	}
+	if matchslicesub := matchPattern(nodepoolNamePattern, logline); matchslicesub != nil {
+		block.Nodepool = matchslicesub[1]
+	}
+	if matchslicesub := matchPattern(blockReasonPattern, logline); matchslicesub != nil && matchslicesub[1] != "" {
+		block.Reason = matchslicesub[1]
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.disruptionblocks = append(e.disruptionblocks, block)
+	return block
+}
+
+// DisruptionBlocks returns a copy of all blocked disruptions parsed by p so far in log order
+func (p *Parser) DisruptionBlocks() []Disruptionblock {
+	p.events.mutex.Lock()
+	defer p.events.mutex.Unlock()
+	return append([]Disruptionblock(nil), p.events.disruptionblocks...)
+}
+
+// Restarts returns a copy of all Karpenter controller start times parsed by p so far in log order
+func (p *Parser) Restarts() []string {
+	p.events.mutex.Lock()
+	defer p.events.mutex.Unlock()
+	return append([]string(nil), p.events.restarts...)
+}
+
+// ProvisioningDecisions returns a copy of all provisioning decisions parsed by p so far in log order
+func (p *Parser) ProvisioningDecisions() []Provisioningdecision {
+	p.events.mutex.Lock()
+	defer p.events.mutex.Unlock()
+	return append([]Provisioningdecision(nil), p.events.provisioningdecisions...)
+}
+
+// ParseKubernetesEvent of p correlates a Karpenter Kubernetes Event of a NodeClaim or Node onto the matching nodeclaim
+// reasons are collected as "|" separated unique list, the message of a DisruptionBlocked event is kept as Disruptionblocked
+// returns false if no tracked nodeclaim matches the involved object
+func (p *Parser) ParseKubernetesEvent(eventtime string, kind string, name string, reason string, message string, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string) bool {
+	nodeclaim := name
+	if kind == "Node" {
+		nodeclaim = (*k8snodenamemap)[name]
+	} else if kind != "NodeClaim" {
+		return false
+	}
+	entry, ok := (*nodeclaimmap)[nodeclaim]
+	if !ok {
+		return false
+	}
+	if reasons := strings.Split(entry.Eventreasons, "|"); entry.Eventreasons == "" {
+		entry.Eventreasons = reason
+	} else if !slices.Contains(reasons, reason) {
+		entry.Eventreasons = fmt.Sprintf("%s|%s", entry.Eventreasons, reason)
+	}
+	if reason == "DisruptionBlocked" {
+		// keep CSV output intact
+		entry.Disruptionblocked = strings.ReplaceAll(message, ",", ";")
+	}
+	(*nodeclaimmap)[nodeclaim] = entry
+	p.traceEvent(eventtime, "event", nodeclaim, reason)
+	return true
+}
+
+// PrintProvisioningDecisions prints all provisioning decisions parsed by p as CSV with the nodeclaims created for each decision
+func (p *Parser) PrintProvisioningDecisions() {
+	decisions := p.ProvisioningDecisions()
+	if len(decisions) == 0 {
+		fmt.Fprintf(os.Stderr, "\nNo results - no provisioning decisions\n")
+		return
+	}
+	fmt.Println("Time,Reconcileid,Nodeclaimcount,Podcount,Nodeclaims,Pods")
+	for _, d := range decisions {
+		fmt.Printf("%s,%s,%s,%s,%s,%s\n", d.Time, d.Reconcileid, d.Nodeclaimcount, d.Podcount, d.Nodeclaims, d.Pods)
+	}
+}
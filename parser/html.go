@@ -0,0 +1,228 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nav-inc/datetime"
+)
+
+// size of embedded SVG charts in pixels
+const (
+	chartWidth  = 800
+	chartHeight = 200
+)
+
+// one bar of the node ready time histogram chart
+type htmlbar struct {
+	Label  string
+	Count  int
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+// data of HTML report template
+type htmlreport struct {
+	Generated   string
+	Nodeclaims  int
+	Header      []string
+	Rows        [][]string
+	Histogram   []htmlbar
+	Timeline    string
+	Maxnodes    int
+	Firsttime   string
+	Lasttime    string
+	ChartWidth  int
+	ChartHeight int
+}
+
+// self-contained HTML page without external resources, so the report can be shared as single file
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>lp4k nodeclaim report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+svg { border: 1px solid #ccc; background: #fafafa; }
+.bar { fill: #4a7ebb; }
+.line { fill: none; stroke: #4a7ebb; stroke-width: 2; }
+.label { font-size: 10px; fill: #444; }
+table { border-collapse: collapse; font-size: 12px; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; white-space: nowrap; }
+th { background: #eee; cursor: pointer; position: sticky; top: 0; }
+tr:nth-child(even) td { background: #f6f6f6; }
+</style>
+</head>
+<body>
+<h1>lp4k nodeclaim report</h1>
+<p>Generated {{.Generated}} with {{.Nodeclaims}} nodeclaims</p>
+<h2>Node ready time histogram</h2>
+<svg width="{{.ChartWidth}}" height="{{.ChartHeight}}" viewBox="0 -15 {{.ChartWidth}} {{.ChartHeight}}">
+{{- range .Histogram}}
+<rect class="bar" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Label}}: {{.Count}}</title></rect>
+<text class="label" x="{{.X}}" y="{{.Y}}" dy="-3">{{.Count}}</text>
+{{- end}}
+</svg>
+<p>{{range $i, $bar := .Histogram}}{{if $i}} | {{end}}{{$bar.Label}}: {{$bar.Count}}{{end}}</p>
+<h2>Nodes over time</h2>
+{{- if .Timeline}}
+<svg width="{{.ChartWidth}}" height="{{.ChartHeight}}" viewBox="0 0 {{.ChartWidth}} {{.ChartHeight}}">
+<path class="line" d="{{.Timeline}}"/>
+<text class="label" x="2" y="12">{{.Maxnodes}} nodes</text>
+</svg>
+<p>{{.Firsttime}} - {{.Lasttime}}</p>
+{{- else}}
+<p>No created nodeclaims</p>
+{{- end}}
+<h2>Nodeclaims</h2>
+<table id="nodeclaims">
+<thead><tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("#nodeclaims th").forEach(function (th, column) {
+  th.addEventListener("click", function () {
+    var tbody = document.querySelector("#nodeclaims tbody");
+    var asc = th.dataset.order !== "asc";
+    th.dataset.order = asc ? "asc" : "desc";
+    var rows = Array.from(tbody.rows);
+    rows.sort(function (a, b) {
+      var x = a.cells[column].textContent, y = b.cells[column].textContent;
+      var nx = parseFloat(x), ny = parseFloat(y);
+      var cmp = (!isNaN(nx) && !isNaN(ny) && String(nx) === x && String(ny) === y) ? nx - ny : x.localeCompare(y);
+      return asc ? cmp : -cmp;
+    });
+    rows.forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// internal helper function to scale histogram counts to SVG bars
+func histogramBars(labels []string, counts []int) []htmlbar {
+	maxcount := 1
+	for _, count := range counts {
+		maxcount = max(maxcount, count)
+	}
+	bars := make([]htmlbar, len(counts))
+	width := float64(chartWidth) / float64(len(counts))
+	for i, count := range counts {
+		height := float64(count) / float64(maxcount) * (chartHeight - 20)
+		bars[i] = htmlbar{
+			Label:  labels[i],
+			Count:  count,
+			X:      float64(i) * width,
+			Y:      chartHeight - 15 - height,
+			Width:  width - 2,
+			Height: height,
+		}
+	}
+	return bars
+}
+
+// internal helper function to compute the number of nodes over time from Createdtime and Deletedtime as SVG step path
+// returns the path, the maximum number of nodes and the first and last time
+func nodesOverTime(nodeclaimmap *map[string]Nodeclaimstruct) (string, int, time.Time, time.Time) {
+	type change struct {
+		time  time.Time
+		delta int
+	}
+	var changes []change
+	for _, v := range *nodeclaimmap {
+		created, err := datetime.Parse(v.Createdtime, time.UTC)
+		if err != nil {
+			continue
+		}
+		changes = append(changes, change{created, 1})
+		if deleted, err := datetime.Parse(v.Deletedtime, time.UTC); err == nil && v.Deleted {
+			changes = append(changes, change{deleted, -1})
+		}
+	}
+	if len(changes) == 0 {
+		return "", 0, time.Time{}, time.Time{}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].time.Before(changes[j].time) })
+	first, last := changes[0].time, changes[len(changes)-1].time
+	nodes, maxnodes := 0, 1
+	for _, c := range changes {
+		nodes += c.delta
+		maxnodes = max(maxnodes, nodes)
+	}
+	span := last.Sub(first).Seconds()
+	xpos := func(t time.Time) float64 {
+		if span == 0 {
+			return 0
+		}
+		return t.Sub(first).Seconds() / span * chartWidth
+	}
+	ypos := func(n int) float64 {
+		return chartHeight - float64(n)/float64(maxnodes)*(chartHeight-20)
+	}
+	var path strings.Builder
+	nodes = 0
+	fmt.Fprintf(&path, "M 0 %.1f", ypos(0))
+	for _, c := range changes {
+		nodes += c.delta
+		fmt.Fprintf(&path, " H %.1f V %.1f", xpos(c.time), ypos(nodes))
+	}
+	fmt.Fprintf(&path, " H %d", chartWidth)
+	return path.String(), maxnodes, first, last
+}
+
+// WriteHTMLReport writes a self-contained HTML page with a sortable nodeclaim table, a node ready time histogram and the number of nodes over time to filename
+// the table uses the same sorting, filters and limit as the other output formats
+func WriteHTMLReport(nodeclaimmap *map[string]Nodeclaimstruct, buckets []time.Duration, filename string) error {
+	report := htmlreport{
+		Generated:   time.Now().UTC().Format(time.RFC3339),
+		Header:      []string{keyname},
+		ChartWidth:  chartWidth,
+		ChartHeight: chartHeight,
+	}
+	reflecttype := reflect.TypeOf(Nodeclaimstruct{})
+	for i := range reflecttype.NumField() {
+		report.Header = append(report.Header, reflecttype.Field(i).Name)
+	}
+	for _, v := range sortLimitResult(nodeclaimmap) {
+		row := []string{v.key}
+		reflectval := reflect.ValueOf(v.value)
+		for i := range reflectval.NumField() {
+			row = append(row, fmt.Sprintf("%v", formatValue(reflectval.Field(i))))
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	report.Nodeclaims = len(report.Rows)
+	report.Histogram = histogramBars(histogramCounts(nodeclaimmap, buckets))
+	var first, last time.Time
+	if report.Timeline, report.Maxnodes, first, last = nodesOverTime(nodeclaimmap); report.Timeline != "" {
+		report.Firsttime = first.Format(time.RFC3339)
+		report.Lasttime = last.Format(time.RFC3339)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := htmlTemplate.Execute(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
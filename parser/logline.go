@@ -0,0 +1,226 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// name reference to a K8s object like "NodeClaim":{"name":"default-abcde"}
+type namedobject struct {
+	Name string `json:"name"`
+}
+
+// Karpenter JSON log line decoded with json.Unmarshal, only keys used by the parser are decoded
+// pointers distinguish absent keys from empty values where Karpenter versions differ in the logged keys
+type karpenterlogline struct {
+	Level                string          `json:"level"`
+	Severity             string          `json:"severity"`
+	Time                 string          `json:"time"`
+	Message              string          `json:"message"`
+	NodePool             *namedobject    `json:"NodePool"`
+	NodeClaim            *namedobject    `json:"NodeClaim"`
+	Node                 *namedobject    `json:"Node"`
+	Requests             map[string]any  `json:"requests"`
+	Instancetypes        *string         `json:"instance-types"`
+	Providerid           *string         `json:"provider-id"`
+	Instancetype         string          `json:"instance-type"`
+	Zone                 string          `json:"zone"`
+	Capacitytype         string          `json:"capacity-type"`
+	Imageid              string          `json:"image-id"`
+	ImageID              string          `json:"imageID"`
+	Amiid                string          `json:"ami-id"`
+	AmiID                string          `json:"amiID"`
+	Reason               *string         `json:"reason"`
+	Command              *string         `json:"command"`
+	Decision             string          `json:"decision"`
+	Commandid            string          `json:"command-id"`
+	Disruptednodecount   json.RawMessage `json:"disrupted-node-count"`
+	Replacementnodecount json.RawMessage `json:"replacement-node-count"`
+	Podcount             json.RawMessage `json:"pod-count"`
+	Disruptednodes       []struct {
+		NodeClaim namedobject `json:"NodeClaim"`
+	} `json:"disrupted-nodes"`
+	Emptyduration string  `json:"empty-duration"`
+	EmptyDuration string  `json:"emptyDuration"`
+	Messagekind   *string `json:"messageKind"`
+	Taintkey      *string `json:"taint.Key"`
+	Taintvalue    string  `json:"taint.Value"`
+	Tainteffect   string  `json:"taint.Effect"`
+}
+
+// internal helper function to decode a structured Karpenter JSON logline, nil for legacy loglines which are no valid JSON object
+// and for loglines whose keys have unexpected types, both are parsed with the regex patterns instead
+func decodeLogline(logline string) *karpenterlogline {
+	if !strings.HasPrefix(logline, "{") {
+		return nil
+	}
+	var record karpenterlogline
+	if err := json.Unmarshal([]byte(logline), &record); err != nil {
+		return nil
+	}
+	return &record
+}
+
+// internal helper function to return submatches of logline in the layout of pattern, from fields of record for structured loglines
+// and from pattern itself for legacy loglines, so every message is handled the same way for both
+func submatches(record *karpenterlogline, fields func() []string, pattern func(string) []string, logline string) []string {
+	if record != nil {
+		return fields()
+	}
+	return pattern(logline)
+}
+
+// internal helper function to return time, nodepool, nodeclaim and instance types of "created nodeclaim" in the layout of createdPattern
+func (r *karpenterlogline) created() []string {
+	if r.NodePool == nil || r.NodeClaim == nil || r.Instancetypes == nil {
+		return nil
+	}
+	return []string{"", r.Time, r.NodePool.Name, r.NodeClaim.Name, *r.Instancetypes}
+}
+
+// internal helper function to return time, nodeclaim and launch details of "launched nodeclaim" in the layout of launchedPattern
+func (r *karpenterlogline) launched() []string {
+	if r.NodeClaim == nil || r.Providerid == nil {
+		return nil
+	}
+	return []string{"", r.Time, r.NodeClaim.Name, *r.Providerid, r.Instancetype, r.Zone, r.Capacitytype}
+}
+
+// internal helper function to return launch details of a combined created and launched logline in the layout of combinedLaunchPattern
+func (r *karpenterlogline) combinedLaunch() []string {
+	if r.Providerid == nil {
+		return nil
+	}
+	return []string{"", *r.Providerid, r.Instancetype, r.Zone, r.Capacitytype}
+}
+
+// internal helper function to return time, nodeclaim and K8s node name in the layout of matchRegistered
+func (r *karpenterlogline) registered() []string {
+	if r.NodeClaim == nil || r.Node == nil {
+		return nil
+	}
+	return []string{"", r.Time, r.NodeClaim.Name, r.Node.Name}
+}
+
+// internal helper function to return time and nodeclaim in the layout of initializedPattern and deletedPattern
+func (r *karpenterlogline) nodeclaim() []string {
+	if r.NodeClaim == nil {
+		return nil
+	}
+	return []string{"", r.Time, r.NodeClaim.Name}
+}
+
+// internal helper function to return time, message kind and nodeclaim of an interruption in the layout of interruptionPattern
+func (r *karpenterlogline) interruption() []string {
+	if r.NodeClaim == nil || r.Messagekind == nil {
+		return nil
+	}
+	return []string{"", r.Time, *r.Messagekind, r.NodeClaim.Name}
+}
+
+// internal helper function to return time, nodeclaim and annotation key/value in the layout of annotatedPattern
+// Karpenter logs the annotation as last key of the logline, which key order of the decoded struct does not preserve
+func (r *karpenterlogline) annotated(logline string) []string {
+	key, value, ok := lastStringField(logline)
+	if r.NodeClaim == nil || !ok {
+		return nil
+	}
+	return []string{"", r.Time, r.NodeClaim.Name, key, value}
+}
+
+// internal helper function to return the layout and submatches of "disrupting node(s)" like matchVersions
+// Karpenter 1.1.x+ logs the disruption "reason", earlier versions the disruption "command"
+func (r *karpenterlogline) disrupting(hinted int) ([]string, int) {
+	version := selectLayout([]bool{r.Reason != nil, r.Command != nil}, hinted)
+	if version < 0 {
+		return nil, -1
+	}
+	reason := r.Reason
+	if version == 1 {
+		reason = r.Command
+	}
+	// like the regex pattern the last disrupted nodeclaim is tracked
+	var nodeclaim string
+	if len(r.Disruptednodes) > 0 {
+		nodeclaim = r.Disruptednodes[len(r.Disruptednodes)-1].NodeClaim.Name
+	}
+	return []string{"", r.Time, *reason, r.Decision, string(r.Disruptednodecount), string(r.Replacementnodecount), string(r.Podcount), nodeclaim}, version
+}
+
+// internal helper function to return the layout and submatches of "tainted node" like matchVersions
+// Karpenter 1.1.x+ logs nodeclaim and taint, 1.0.x K8s node name and taint, 0.37.x K8s node name only
+func (r *karpenterlogline) tainted(hinted int) ([]string, int) {
+	hastaint := r.Taintkey != nil
+	switch version := selectLayout([]bool{r.NodeClaim != nil && hastaint, r.Node != nil && hastaint, r.Node != nil}, hinted); version {
+	case 0:
+		return []string{"", r.Time, r.NodeClaim.Name, *r.Taintkey, r.Taintvalue, r.Tainteffect}, version
+	case 1:
+		return []string{"", r.Time, r.Node.Name, *r.Taintkey, r.Taintvalue, r.Tainteffect}, version
+	case 2:
+		return []string{"", r.Time, r.Node.Name}, version
+	}
+	return nil, -1
+}
+
+// internal helper function to return requested cpu, memory and pods like requestedResources
+func (r *karpenterlogline) requested() (string, string, string) {
+	resource := func(name string) string {
+		val, _ := r.Requests[name].(string)
+		return val
+	}
+	return resource("cpu"), resource("memory"), resource("pods")
+}
+
+// internal helper function to return the AMI ID like amiID
+func (r *karpenterlogline) amiID() string {
+	for _, val := range []string{r.Imageid, r.ImageID, r.Amiid, r.AmiID} {
+		if strings.HasPrefix(val, "ami-") {
+			return val
+		}
+	}
+	return ""
+}
+
+// internal helper function to select the layout of a structured logline like matchVersions, matches holds which layouts the decoded keys fit
+// hinted is the layout of a "#karpenter-version:" directive, -1 without directive
+func selectLayout(matches []bool, hinted int) int {
+	if hinted >= 0 {
+		if matches[hinted] {
+			return hinted
+		}
+		return -1
+	}
+	for i, ok := range matches {
+		if ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// internal helper function to return the last top-level key with a string value of a JSON logline in logged key order
+func lastStringField(logline string) (string, string, bool) {
+	decoder := json.NewDecoder(strings.NewReader(logline))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return "", "", false
+	}
+	var key, value string
+	var found bool
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", "", false
+		}
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return "", "", false
+		}
+		var val string
+		if json.Unmarshal(raw, &val) == nil {
+			key, value, found = token.(string), val, true
+		}
+	}
+	return key, value, found
+}
@@ -0,0 +1,142 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// upper bounds in seconds of node ready and node termination time histogram buckets
+var (
+	readybuckets       = []float64{15, 30, 45, 60, 90, 120, 180, 300, 600}
+	terminationbuckets = []float64{30, 60, 120, 300, 600, 1200, 1800, 3600}
+)
+
+// cumulative Prometheus histogram
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// labels of nodeclaim metrics
+type metriclabels struct {
+	nodepool     string
+	capacitytype string
+}
+
+// nodeclaim metrics of a Parser updated while parsing, guarded by mutex because pod log streams are parsed concurrently
+type nodeclaimmetrics struct {
+	mutex                 sync.Mutex
+	readyhistograms       map[metriclabels]*histogram
+	terminationhistograms map[metriclabels]*histogram
+	// number of nodeclaims per labels and lifecycle stage like "launched" or "deleted"
+	stagecounters map[metriclabels]map[string]uint64
+	// number of created nodeclaims per nodepool, counted separately because capacity type is unknown before launch
+	createdcounters map[string]uint64
+}
+
+// internal helper function to create empty nodeclaim metrics
+func newNodeclaimmetrics() nodeclaimmetrics {
+	return nodeclaimmetrics{
+		readyhistograms:       make(map[metriclabels]*histogram),
+		terminationhistograms: make(map[metriclabels]*histogram),
+		stagecounters:         make(map[metriclabels]map[string]uint64),
+		createdcounters:       make(map[string]uint64),
+	}
+}
+
+// internal helper function to add an observation to the histogram of labels, creating it with buckets on first use
+func observeHistogram(histograms map[metriclabels]*histogram, labels metriclabels, buckets []float64, val float64) {
+	h := histograms[labels]
+	if h == nil {
+		h = &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		histograms[labels] = h
+	}
+	for i, bound := range h.buckets {
+		if val <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += val
+	h.count++
+}
+
+// internal helper function to update nodeclaim metrics when a nodeclaim reached a lifecycle stage
+// node ready time is observed on "initialized", node termination time on "deleted" if the disruption annotation was logged
+func (m *nodeclaimmetrics) observeStage(stage string, entry Nodeclaimstruct) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if stage == "created" {
+		m.createdcounters[entry.Nodepool]++
+		return
+	}
+	labels := metriclabels{entry.Nodepool, entry.Capacitytype}
+	if m.stagecounters[labels] == nil {
+		m.stagecounters[labels] = make(map[string]uint64)
+	}
+	m.stagecounters[labels][stage]++
+	switch stage {
+	case "initialized":
+		if entry.Createdtime != "" && entry.Initializedtime != "" {
+			observeHistogram(m.readyhistograms, labels, readybuckets, entry.Nodereadytimesec)
+		}
+	case "deleted":
+		if entry.Disruptionannotationtime != "" && entry.Deletedtime != "" {
+			observeHistogram(m.terminationhistograms, labels, terminationbuckets, entry.Nodeterminationtimesec)
+		}
+	}
+}
+
+// internal helper function to return labels sorted by nodepool and capacity type
+func sortedLabels[V any](m map[metriclabels]V) []metriclabels {
+	return slices.SortedFunc(maps.Keys(m), func(a, b metriclabels) int {
+		return cmp.Or(cmp.Compare(a.nodepool, b.nodepool), cmp.Compare(a.capacitytype, b.capacitytype))
+	})
+}
+
+// internal helper function to write histograms in Prometheus text format
+func writeHistograms(w io.Writer, name string, help string, histograms map[metriclabels]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, labels := range sortedLabels(histograms) {
+		h := histograms[labels]
+		base := fmt.Sprintf("nodepool=%q,capacity_type=%q", labels.nodepool, labels.capacitytype)
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, base, strconv.FormatFloat(bound, 'f', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, base, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, base, strconv.FormatFloat(h.sum, 'f', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, base, h.count)
+	}
+}
+
+// WriteMetrics writes node ready and termination time histograms and nodeclaim counters per nodepool, capacity type and lifecycle stage
+// of all nodeclaims parsed by p in Prometheus text format
+// created nodeclaims are counted per nodepool only, as their capacity type is not known before launch
+func (p *Parser) WriteMetrics(w io.Writer) {
+	m := &p.metrics
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	writeHistograms(w, "lp4k_nodeclaim_ready_seconds", "Time from nodeclaim creation until its node is initialized.", m.readyhistograms)
+	writeHistograms(w, "lp4k_nodeclaim_termination_seconds", "Time from disruption annotation until nodeclaim deletion.", m.terminationhistograms)
+	fmt.Fprintf(w, "# HELP lp4k_nodeclaims_created_total Number of created nodeclaims.\n")
+	fmt.Fprintf(w, "# TYPE lp4k_nodeclaims_created_total counter\n")
+	for _, nodepool := range slices.Sorted(maps.Keys(m.createdcounters)) {
+		fmt.Fprintf(w, "lp4k_nodeclaims_created_total{nodepool=%q} %d\n", nodepool, m.createdcounters[nodepool])
+	}
+	fmt.Fprintf(w, "# HELP lp4k_nodeclaims_total Number of nodeclaims which reached a lifecycle stage.\n")
+	fmt.Fprintf(w, "# TYPE lp4k_nodeclaims_total counter\n")
+	for _, labels := range sortedLabels(m.stagecounters) {
+		for _, stage := range slices.Sorted(maps.Keys(m.stagecounters[labels])) {
+			fmt.Fprintf(w, "lp4k_nodeclaims_total{nodepool=%q,capacity_type=%q,stage=%q} %d\n", labels.nodepool, labels.capacitytype, stage, m.stagecounters[labels][stage])
+		}
+	}
+}
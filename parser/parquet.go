@@ -0,0 +1,253 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Parquet physical types, encodings and Thrift compact protocol field types used by the writer
+const (
+	parquetMagic = "PAR1"
+
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetPlain         = 0
+	parquetRLE           = 3
+	parquetUTF8          = 0
+	parquetRequired      = 0
+	parquetUncompressed  = 0
+	parquetDataPage      = 0
+	parquetFormatVersion = 1
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// writer of Thrift compact protocol structs as used by Parquet page headers and file metadata
+type thriftWriter struct {
+	buffer bytes.Buffer
+	// last written field ID per nested struct
+	lastid []int
+}
+
+// internal helper function to write the header of field id of type fieldtype within the current struct
+func (w *thriftWriter) field(id int, fieldtype byte) {
+	last := &w.lastid[len(w.lastid)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buffer.WriteByte(byte(delta)<<4 | fieldtype)
+	} else {
+		w.buffer.WriteByte(fieldtype)
+		w.buffer.Write(binary.AppendVarint(nil, int64(id)))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int, val int32) {
+	w.field(id, thriftI32)
+	w.buffer.Write(binary.AppendVarint(nil, int64(val)))
+}
+
+func (w *thriftWriter) i64(id int, val int64) {
+	w.field(id, thriftI64)
+	w.buffer.Write(binary.AppendVarint(nil, val))
+}
+
+func (w *thriftWriter) str(id int, val string) {
+	w.field(id, thriftBinary)
+	w.rawstr(val)
+}
+
+// internal helper function to write a string without field header like list elements
+func (w *thriftWriter) rawstr(val string) {
+	w.buffer.Write(binary.AppendUvarint(nil, uint64(len(val))))
+	w.buffer.WriteString(val)
+}
+
+// internal helper function to write the header of list field id with size elements of elemtype
+func (w *thriftWriter) list(id int, elemtype byte, size int) {
+	w.field(id, thriftList)
+	if size < 15 {
+		w.buffer.WriteByte(byte(size)<<4 | elemtype)
+	} else {
+		w.buffer.WriteByte(0xf0 | elemtype)
+		w.buffer.Write(binary.AppendUvarint(nil, uint64(size)))
+	}
+}
+
+// internal helper function to start a struct, id 0 starts a list element or the top-level struct without field header
+func (w *thriftWriter) begin(id int) {
+	if id > 0 {
+		w.field(id, thriftStruct)
+	}
+	w.lastid = append(w.lastid, 0)
+}
+
+func (w *thriftWriter) end() {
+	w.buffer.WriteByte(0)
+	w.lastid = w.lastid[:len(w.lastid)-1]
+}
+
+// one Parquet column of nodeclaim output with its PLAIN encoded values
+type parquetcolumn struct {
+	name      string
+	ptype     int32
+	values    bytes.Buffer
+	boolcount int
+}
+
+// internal helper function to return the Parquet physical type of a Nodeclaimstruct field, fields without native type are written as strings
+func parquetType(fieldtype reflect.Type) int32 {
+	switch kind := fieldtype.Kind(); {
+	case fieldtype == reflect.TypeOf(time.Duration(0)):
+		// durations are rendered like in CSV and JSON, see LP4K_DURATION_FORMAT
+		return parquetByteArray
+	case kind == reflect.Bool:
+		return parquetBoolean
+	case kind == reflect.Int, kind == reflect.Int64:
+		return parquetInt64
+	case kind == reflect.Float64:
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// internal helper function to append a value to a PLAIN encoded column
+func (c *parquetcolumn) append(val any) {
+	switch c.ptype {
+	case parquetBoolean:
+		// booleans are bit-packed, least significant bit first
+		if c.boolcount%8 == 0 {
+			c.values.WriteByte(0)
+		}
+		if val.(bool) {
+			c.values.Bytes()[c.values.Len()-1] |= 1 << (c.boolcount % 8)
+		}
+		c.boolcount++
+	case parquetInt64:
+		c.values.Write(binary.LittleEndian.AppendUint64(nil, uint64(reflect.ValueOf(val).Int())))
+	case parquetDouble:
+		c.values.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(val.(float64))))
+	default:
+		s := fmt.Sprint(val)
+		c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s))))
+		c.values.WriteString(s)
+	}
+}
+
+// ConvertToParquet converts nodeclaimmap to a Parquet file with one row per nodeclaim and one column per CSV column
+// all nodeclaims are written as single row group of uncompressed, PLAIN encoded required columns, which Athena, Spark and pandas read
+func ConvertToParquet(nodeclaimmap *map[string]Nodeclaimstruct) string {
+	s := sortLimitResult(nodeclaimmap)
+	reflecttype := reflect.TypeOf(Nodeclaimstruct{})
+	columns := []*parquetcolumn{{name: keyname, ptype: parquetByteArray}}
+	for i := range reflecttype.NumField() {
+		field := reflecttype.Field(i)
+		columns = append(columns, &parquetcolumn{name: field.Name, ptype: parquetType(field.Type)})
+	}
+	for _, v := range s {
+		columns[0].append(v.key)
+		reflectval := reflect.ValueOf(v.value)
+		for i := range reflectval.NumField() {
+			if columns[i+1].ptype == parquetByteArray {
+				columns[i+1].append(formatValue(reflectval.Field(i)))
+			} else {
+				columns[i+1].append(reflectval.Field(i).Interface())
+			}
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+	// column chunks, each a single data page
+	offsets := make([]int64, len(columns))
+	sizes := make([]int64, len(columns))
+	for i, c := range columns {
+		var header thriftWriter
+		header.begin(0)
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(c.values.Len()))
+		header.i32(3, int32(c.values.Len()))
+		header.begin(5)
+		header.i32(1, int32(len(s)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+		offsets[i] = int64(file.Len())
+		sizes[i] = int64(header.buffer.Len() + c.values.Len())
+		file.Write(header.buffer.Bytes())
+		file.Write(c.values.Bytes())
+	}
+
+	// file metadata
+	var meta thriftWriter
+	meta.begin(0)
+	meta.i32(1, parquetFormatVersion)
+	meta.list(2, thriftStruct, len(columns)+1)
+	meta.begin(0)
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.end()
+	for _, c := range columns {
+		meta.begin(0)
+		meta.i32(1, c.ptype)
+		meta.i32(3, parquetRequired)
+		meta.str(4, c.name)
+		if c.ptype == parquetByteArray {
+			meta.i32(6, parquetUTF8)
+		}
+		meta.end()
+	}
+	meta.i64(3, int64(len(s)))
+	if len(s) == 0 {
+		meta.list(4, thriftStruct, 0)
+	} else {
+		var total int64
+		for _, size := range sizes {
+			total += size
+		}
+		meta.list(4, thriftStruct, 1)
+		meta.begin(0)
+		meta.list(1, thriftStruct, len(columns))
+		for i, c := range columns {
+			meta.begin(0)
+			meta.i64(2, offsets[i])
+			meta.begin(3)
+			meta.i32(1, c.ptype)
+			meta.list(2, thriftI32, 1)
+			meta.buffer.Write(binary.AppendVarint(nil, parquetPlain))
+			meta.list(3, thriftBinary, 1)
+			meta.rawstr(c.name)
+			meta.i32(4, parquetUncompressed)
+			meta.i64(5, int64(len(s)))
+			meta.i64(6, sizes[i])
+			meta.i64(7, sizes[i])
+			meta.i64(9, offsets[i])
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, total)
+		meta.i64(3, int64(len(s)))
+		meta.end()
+	}
+	meta.str(6, "lp4k")
+	meta.end()
+
+	file.Write(meta.buffer.Bytes())
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(meta.buffer.Len())))
+	file.WriteString(parquetMagic)
+	return file.String()
+}
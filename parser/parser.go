@@ -4,24 +4,83 @@ package parser
 
 import (
 	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/nav-inc/datetime"
 )
 
+const (
+	// environment variables
+	traceEnv                 = "LP4K_TRACE_EVENTS"
+	ignoremessagesEnv        = "LP4K_IGNORE_MESSAGES"
+	onlynodepoolEnv          = "LP4K_ONLY_NODEPOOL"
+	nodeclaimlistEnv         = "LP4K_NODECLAIM_LIST"
+	readyslaEnv              = "LP4K_READY_SLA"
+	tolerantEnv              = "LP4K_TOLERANT"
+	disruptionannotationsEnv = "LP4K_DISRUPTION_ANNOTATIONS"
+	maxlinesEnv              = "LP4K_MAX_LINES"
+	// journald JSON export field, used to detect journald records
+	journaldTimestampKey = `"__REALTIME_TIMESTAMP"`
+)
+
 // var header string = "nodeclaim,createdtime,nodepool,instancetypes,launchedtime,providerid,instancetype,zone,capacitytype,registeredtime,k8snodename,initializedtime,nodereadytime,nodereadytimesec,disruptiontime,disruptionreason,disruptiondecision,disruptednodecount,replacementnodecount,disruptedpodcount,annotationtime,annotation,tainttime,taint,interruptiontime,interruptionkind,deletedtime,nodeterminationtime,nodeterminationtimesec,nodelifecycletime,nodelifecycletimesec,initialized,deleted"
 var header string
 
+// Options are the parsing options of a Parser, NewParser determines them via OS environment
+// options only affecting output like LP4K_OUTPUT_FORMAT, SetLimit or SetLatest are package wide instead
+type Options struct {
+	// print every parsed event as one line to STDERR
+	Trace bool
+	// skip lines which are no Karpenter JSON log lines before any pattern matching, for streams interleaved with other output
+	Tolerant bool
+	// maximum number of parsed lines, 0 means unlimited
+	Maxlines int64
+	// annotation keys which start the disruption lifecycle of a nodeclaim, the first one sets Disruptionannotationtime
+	// nil means the default keys "karpenter.sh/nodeclaim-termination-timestamp" and "karpenter.sh/disruption"
+	Disruptionannotations map[string]bool
+	// Karpenter log messages which are skipped entirely
+	Ignoremessages map[string]bool
+	// node ready time SLA, 0 means disabled
+	Readysla time.Duration
+	// only nodepool whose nodeclaims are tracked, empty means all nodepools
+	Onlynodepool string
+	// nodeclaim names to track, nil means all nodeclaims
+	Nodeclaimlist map[string]bool
+	// record input file and line of the "created nodeclaim" logline as Sourcefile and Sourceline
+	Recordsource bool
+	// consume leading "#lp4k-format:" and "#karpenter-version:" lines of input files as parsing hints
+	Formatdirectives bool
+	// profile parsing time per message
+	Profile bool
+}
+
+// parsing options determined via OS environment, used by NewParser
+var envoptions = Options{Ignoremessages: make(map[string]bool)}
+
+// default annotation keys which start the disruption lifecycle of a nodeclaim
+var defaultdisruptionannotations = map[string]bool{"karpenter.sh/nodeclaim-termination-timestamp": true, "karpenter.sh/disruption": true}
+
 var (
 	replacer                 = strings.NewReplacer(", ", "|", " ", "", "(s)", "s")
 	messagePattern           = regexp.MustCompile(`"message":"(.*)","commit"`)
+	levelPattern             = regexp.MustCompile(`"(?:level|severity)":"([A-Za-z]+)"`)
 	createdPattern           = regexp.MustCompile(`"time":"(.*)","logger".*"NodePool":{"name":"(.*)"},"NodeClaim":{"name":"(.*)"},"requests".*"instance-types":"(.*)"`)
 	launchedPattern          = regexp.MustCompile(`"time":"(.*)","logger".*"NodeClaim":{"name":"(.*)"},.*"provider-id":"(.*)","instance-type":"(.*)","zone":"(.*)","capacity-type":"(.*)","allocatable"`)
-	registeredPattern        = regexp.MustCompile(`"time":"(.*)","logger".*"NodeClaim":{"name":"(.*)"},.*,"Node":{"name":"(.*)"`)
+	timePattern              = regexp.MustCompile(`"time":"([^"]*)"`)
+	nodeclaimNamePattern     = regexp.MustCompile(`"NodeClaim":{"name":"([^"]*)"}`)
+	nodeNamePattern          = regexp.MustCompile(`"Node":{"name":"([^"]*)"}`)
 	initializedPattern       = regexp.MustCompile(`"time":"(.*)","logger".*"NodeClaim":{"name":"(.*)"},"namespace"`)
 	disruptingReasonPattern  = regexp.MustCompile(`"time":"(.*)","logger".*"reason":"(.*)","decision":"(.*)","disrupted-node-count":(.*),"replacement-node-count":(.*),"pod-count":(.*),"disrupted-nodes":.*,"NodeClaim":{"name":"(.*)"},"capacity-type"`)
 	disruptingCommandPattern = regexp.MustCompile(`"time":"(.*)","logger".*"command":"(.*)","decision":"(.*)","disrupted-node-count":(.*),"replacement-node-count":(.*),"pod-count":(.*),"disrupted-nodes":.*,"NodeClaim":{"name":"(.*)"},"capacity-type"`)
@@ -30,44 +89,280 @@ var (
 	taintedNCPattern         = regexp.MustCompile(`"time":"(.*)","logger".*"NodeClaim":{"name":"(.*)"},"taint.Key":"(.*)","taint.Value":"(.*)","taint.Effect":"(.*)"`)
 	taintedNodePattern       = regexp.MustCompile(`"time":"(.*)","logger".*"Node":{"name":"(.*)"},"namespace".*,"taint.Key":"(.*)","taint.Value":"(.*)","taint.Effect":"(.*)"`)
 	taintedNodeSimplePattern = regexp.MustCompile(`"time":"(.*)","logger".*"Node":{"name":"(.*)"},"namespace"`)
+	overflowPattern          = regexp.MustCompile(`,?\s+and\s+(\d+)\s+other(?:\(s\)|s)?\s*$`)
+	requestsPattern          = regexp.MustCompile(`"requests":{([^}]*)}`)
+	combinedLaunchPattern    = regexp.MustCompile(`"provider-id":"([^"]*)","instance-type":"([^"]*)","zone":"([^"]*)","capacity-type":"([^"]*)"`)
+	commandIDPattern         = regexp.MustCompile(`"command-id":"([^"]*)"`)
+	emptydurationPattern     = regexp.MustCompile(`"(?:empty-duration|emptyDuration)":"([^"]*)"`)
+	amiidPattern             = regexp.MustCompile(`"(?:image-id|imageID|ami-id|amiID)":"(ami-[^"]*)"`)
 	deletedPattern           = regexp.MustCompile(`"time":"(.*)","logger".*"NodeClaim":{"name":"(.*)"},"namespace"`)
 )
 
+// layouts of messages which differ between Karpenter versions, most specific first, see matchVersions
+var (
+	disruptingPatterns = []*regexp.Regexp{disruptingReasonPattern, disruptingCommandPattern}
+	taintedPatterns    = []*regexp.Regexp{taintedNCPattern, taintedNodePattern, taintedNodeSimplePattern}
+)
+
+// Parser holds all state of parsing Karpenter logs besides nodeclaimmap and k8snodenamemap, which are passed to every parsing call
+// one Parser is shared by all inputs and pod log streams of a run, independent Parsers like in tests and benchmarks never share state
+type Parser struct {
+	// parsing options, see Options
+	options Options
+	// JSON fragment of options.Onlynodepool, loglines without it are skipped before extraction
+	onlynodepoolfragment string
+	// parsing hints of the input file being parsed, see ResilientParser
+	hints formathints
+	// number of parsed lines, linebudget is closed once LP4K_MAX_LINES lines are parsed
+	parsedlines atomic.Int64
+	linebudget  chan struct{}
+	// number of nodeclaims exceeding LP4K_READY_SLA
+	readyslabreaches atomic.Int64
+	events           clusterevents
+	metrics          nodeclaimmetrics
+	readyquantiles   readyestimators
+	profiling        parseprofile
+}
+
+// NewParser returns a Parser with options determined via OS environment which has not parsed anything yet
+func NewParser() *Parser {
+	return NewParserWithOptions(envoptions)
+}
+
+// NewParserWithOptions returns a Parser with options which has not parsed anything yet, independent of the OS environment
+func NewParserWithOptions(options Options) *Parser {
+	if options.Disruptionannotations == nil {
+		options.Disruptionannotations = defaultdisruptionannotations
+	}
+	var onlynodepoolfragment string
+	if options.Onlynodepool != "" {
+		onlynodepoolfragment = fmt.Sprintf(`"NodePool":{"name":"%s"}`, options.Onlynodepool)
+	}
+	return &Parser{
+		options:              options,
+		onlynodepoolfragment: onlynodepoolfragment,
+		linebudget:           make(chan struct{}),
+		events:               clusterevents{provisionablepods: make(map[string]string)},
+		metrics:              newNodeclaimmetrics(),
+		readyquantiles:       readyestimators{estimators: newReadyQuantiles()},
+		profiling:            parseprofile{messages: make(map[string]*profilestruct)},
+	}
+}
+
 // export all struct values because this is required for usage with packages like JSON encoding/decoding or reflect
 // keep disruptednodecount, replacementnodecount, disruptedpodcount as strings because then we can have empty string ("") to differ from real values
 type Nodeclaimstruct struct {
-	Createdtime            string
-	Nodepool               string
-	Instancetypes          string
-	Launchedtime           string
-	Providerid             string
-	Instancetype           string
-	Zone                   string
-	Capacitytype           string
-	Registeredtime         string
-	K8snodename            string
-	Initializedtime        string
-	Nodereadytime          time.Duration
-	Nodereadytimesec       float64
-	Disruptiontime         string
-	Disruptionreason       string
-	Disruptiondecision     string
-	Disruptednodecount     string
-	Replacementnodecount   string
-	Disruptedpodcount      string
-	Annotationtime         string
-	Annotation             string
-	Tainttime              string
-	Taint                  string
-	Interruptiontime       string
-	Interruptionkind       string
-	Deletedtime            string
-	Nodeterminationtime    time.Duration
-	Nodeterminationtimesec float64
-	Nodelifecycletime      time.Duration
-	Nodelifecycletimesec   float64
-	Initialized            bool
-	Deleted                bool
+	Createdtime              string
+	Nodepool                 string
+	Instancetypes            string
+	Instancetypesoverflow    int
+	Requestedcpu             string
+	Requestedmemory          string
+	Requestedpods            string
+	Launchedtime             string
+	Providerid               string
+	Instancetype             string
+	Instancefamily           string
+	Vcpus                    int
+	Memorymib                int
+	Arch                     string
+	Zone                     string
+	Capacitytype             string
+	Amiid                    string
+	Registeredtime           string
+	K8snodename              string
+	Registrationtimeoutsec   float64
+	Initializedtime          string
+	Nodereadytime            time.Duration
+	Nodereadytimesec         float64
+	Bootreadytime            time.Duration
+	Bootreadytimesec         float64
+	Disruptiontime           string
+	Disruptionreason         string
+	Disruptiondecision       string
+	Disruptioncommandid      string
+	Disruptionblocked        string
+	Disruptednodecount       string
+	Replacementnodecount     string
+	Disruptedpodcount        string
+	Emptydurationsec         float64
+	Annotationtime           string
+	Annotation               string
+	Disruptionannotationtime string
+	Tainttime                string
+	Taint                    string
+	Interruptiontime         string
+	Interruptionkind         string
+	Interruptioncategory     string
+	Deletedtime              string
+	Nodeterminationtime      time.Duration
+	Nodeterminationtimesec   float64
+	Nodelifecycletime        time.Duration
+	Nodelifecycletimesec     float64
+	Eventreasons             string
+	Maxloglevel              string
+	Initialized              bool
+	Deleted                  bool
+	Failedregistration       bool
+	Spannedrestart           bool
+	Sourcefile               string
+	Sourceline               int
+}
+
+// internal helper function to return the next free versioned key "name.N" for a reused nodeclaim name
+// "." instead of "#" keeps the key a valid ConfigMap key
+func versionedName(nodeclaimmap *map[string]Nodeclaimstruct, nodeclaim string) string {
+	for version := 2; ; version++ {
+		name := fmt.Sprintf("%s.%d", nodeclaim, version)
+		if _, ok := (*nodeclaimmap)[name]; !ok {
+			return name
+		}
+	}
+}
+
+// known interruption message kinds of all Karpenter versions and EC2 event types and their stable category
+var interruptioncategories = map[string]string{
+	"spot_interrupted":         "spot-interruption",
+	"spotinterruption":         "spot-interruption",
+	"rebalance_recommendation": "rebalance-recommendation",
+	"rebalancerecommendation":  "rebalance-recommendation",
+	"scheduled_change":         "scheduled-maintenance",
+	"scheduledchange":          "scheduled-maintenance",
+	"state_change":             "instance-stopped",
+	"statechange":              "instance-stopped",
+	"instance_stopping":        "instance-stopped",
+	"instance_stopped":         "instance-stopped",
+	"instance_terminating":     "instance-stopped",
+	"instance_terminated":      "instance-stopped",
+}
+
+// internal helper function to normalize an interruption message kind to its category, unknown kinds are passed through
+func interruptionCategory(kind string) string {
+	if category, ok := interruptioncategories[strings.ToLower(kind)]; ok {
+		return category
+	}
+	return kind
+}
+
+// internal helper function to return the AMI ID of a launch logline, empty if the Karpenter version does not log it
+func amiID(record *karpenterlogline, logline string) string {
+	if record != nil {
+		return record.amiID()
+	}
+	if matchslicesub := matchPattern(amiidPattern, logline); matchslicesub != nil {
+		return matchslicesub[1]
+	}
+	return ""
+}
+
+// internal helper function to return requested cpu, memory and pods of the "requests" object of a created nodeclaim, empty if absent
+func requestedResources(record *karpenterlogline, logline string) (string, string, string) {
+	if record != nil {
+		return record.requested()
+	}
+	matchslicesub := matchPattern(requestsPattern, logline)
+	if matchslicesub == nil {
+		return "", "", ""
+	}
+	resources := make(map[string]string)
+	for _, resource := range []string{"cpu", "memory", "pods"} {
+		if _, val, ok := strings.Cut(matchslicesub[1], fmt.Sprintf(`"%s":"`, resource)); ok {
+			resources[resource], _, _ = strings.Cut(val, `"`)
+		}
+	}
+	return resources["cpu"], resources["memory"], resources["pods"]
+}
+
+// internal helper function to return the MESSAGE field of a journald JSON export record, other lines are returned unchanged
+// journald exports MESSAGE as array of bytes if it is not valid UTF-8
+func unwrapJournald(logline string) string {
+	var record struct {
+		Message json.RawMessage `json:"MESSAGE"`
+	}
+	if err := json.Unmarshal([]byte(logline), &record); err != nil || record.Message == nil {
+		return logline
+	}
+	var message string
+	if err := json.Unmarshal(record.Message, &message); err == nil {
+		return message
+	}
+	var messagebytes []byte
+	var messageints []int
+	if err := json.Unmarshal(record.Message, &messageints); err == nil {
+		for _, b := range messageints {
+			messagebytes = append(messagebytes, byte(b))
+		}
+		return string(messagebytes)
+	}
+	return logline
+}
+
+// internal helper function to cheaply check if logline looks like a Karpenter JSON log line i.e. a JSON object with "logger" and "message"
+func isKarpenterLogline(logline string) bool {
+	return strings.HasPrefix(strings.TrimSpace(logline), "{") && strings.Contains(logline, `"logger":`) && strings.Contains(logline, `"message":`)
+}
+
+// internal helper function to determine parser options via OS environment
+func init() {
+	envoptions.Trace, _ = strconv.ParseBool(os.Getenv(traceEnv))
+	envoptions.Tolerant, _ = strconv.ParseBool(os.Getenv(tolerantEnv))
+	if val := os.Getenv(maxlinesEnv); val != "" {
+		var err error
+		if envoptions.Maxlines, err = strconv.ParseInt(val, 10, 64); err != nil || envoptions.Maxlines <= 0 {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s, must be a positive number of lines\n", maxlinesEnv)
+			os.Exit(1)
+		}
+	}
+	// comma separated list of annotation keys like "karpenter.sh/disruption"
+	if val := os.Getenv(disruptionannotationsEnv); val != "" {
+		envoptions.Disruptionannotations = make(map[string]bool)
+		for key := range strings.SplitSeq(val, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				envoptions.Disruptionannotations[key] = true
+			}
+		}
+	}
+	// comma separated list of messages like "annotated nodeclaim,tainted node"
+	for message := range strings.SplitSeq(os.Getenv(ignoremessagesEnv), ",") {
+		if message = strings.TrimSpace(message); message != "" {
+			envoptions.Ignoremessages[message] = true
+		}
+	}
+	if val := os.Getenv(readyslaEnv); val != "" {
+		var err error
+		if envoptions.Readysla, err = time.ParseDuration(val); err != nil || envoptions.Readysla <= 0 {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s, must be a positive time.Duration format like \"300s\" or \"5m\"\n", readyslaEnv)
+			os.Exit(1)
+		}
+	}
+	if val := os.Getenv(onlynodepoolEnv); val != "" {
+		envoptions.Onlynodepool = val
+	}
+	// file with one nodeclaim name per line, empty lines and lines starting with "#" are ignored
+	if val := os.Getenv(nodeclaimlistEnv); val != "" {
+		content, err := os.ReadFile(val)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s - %s\n", nodeclaimlistEnv, err.Error())
+			os.Exit(1)
+		}
+		envoptions.Nodeclaimlist = make(map[string]bool)
+		for name := range strings.Lines(string(content)) {
+			if name = strings.TrimSpace(name); name != "" && !strings.HasPrefix(name, "#") {
+				envoptions.Nodeclaimlist[name] = true
+			}
+		}
+	}
+}
+
+// severity ranking of Karpenter log levels, unknown levels rank lowest
+var loglevels = map[string]int{"DEBUG": 1, "INFO": 2, "WARN": 3, "WARNING": 3, "ERROR": 4, "DPANIC": 5, "PANIC": 5, "FATAL": 6}
+
+// internal helper function to return the more severe of two log levels
+func maxLoglevel(current, level string) string {
+	if loglevels[level] > loglevels[current] {
+		return level
+	}
+	return current
 }
 
 // internal helper function for pattern matching
@@ -75,6 +370,162 @@ func matchPattern(pattern *regexp.Regexp, logline string) []string {
 	return pattern.FindStringSubmatch(logline)
 }
 
+// internal helper function to match logline against the layouts of a message in all known Karpenter versions
+// every line is matched on its own, so streams mixing Karpenter versions during an upgrade parse fully
+// patterns are ordered most specific first and the first match wins, returns the submatches and index of the matching pattern or nil and -1
+// hinted is the pattern of the Karpenter version of a "#karpenter-version:" directive, which restricts matching to it, -1 without directive
+func matchVersions(patterns []*regexp.Regexp, hinted int, logline string) ([]string, int) {
+	if hinted >= 0 {
+		if matchslicesub := matchPattern(patterns[hinted], logline); matchslicesub != nil {
+			return matchslicesub, hinted
+		}
+		return nil, -1
+	}
+	for i, pattern := range patterns {
+		if matchslicesub := matchPattern(pattern, logline); matchslicesub != nil {
+			return matchslicesub, i
+		}
+	}
+	return nil, -1
+}
+
+// internal helper function to return submatches and layout index like matchVersions, from fields of record for structured loglines
+// since holds the minimum Karpenter version of each layout to apply the version hint of p
+func (p *Parser) versionedSubmatches(record *karpenterlogline, fields func(int) ([]string, int), patterns []*regexp.Regexp, since [][]int, logline string) ([]string, int) {
+	hinted := p.hints.hintedLayout(since)
+	if record != nil {
+		return fields(hinted)
+	}
+	return matchVersions(patterns, hinted, logline)
+}
+
+// internal helper function to extract time, nodeclaim and K8s node name of a "registered nodeclaim" logline independent of key order
+// Karpenter versions differ in the order of "Node" and "NodeClaim", returns the same slice layout like matchPattern or nil
+func matchRegistered(logline string) []string {
+	timeslice := matchPattern(timePattern, logline)
+	nodeclaimslice := matchPattern(nodeclaimNamePattern, logline)
+	nodeslice := matchPattern(nodeNamePattern, logline)
+	if timeslice == nil || nodeclaimslice == nil || nodeslice == nil {
+		return nil
+	}
+	return []string{logline, timeslice[1], nodeclaimslice[1], nodeslice[1]}
+}
+
+// internal helper function to extract time and nodeclaim of a legacy logline independent of key order, returns the same slice layout like initializedPattern or nil
+func matchNodeclaim(logline string) []string {
+	timeslice := matchPattern(timePattern, logline)
+	nodeclaimslice := matchPattern(nodeclaimNamePattern, logline)
+	if timeslice == nil || nodeclaimslice == nil {
+		return nil
+	}
+	return []string{logline, timeslice[1], nodeclaimslice[1]}
+}
+
+// internal helper function to return the log level of a logline, empty if absent
+func logLevel(record *karpenterlogline, logline string) string {
+	if record != nil {
+		return cmp.Or(record.Level, record.Severity)
+	}
+	if matchslicesub := matchPattern(levelPattern, logline); matchslicesub != nil {
+		return matchslicesub[1]
+	}
+	return ""
+}
+
+// internal helper function to return the disruption command ID of a logline, empty if absent
+func commandID(record *karpenterlogline, logline string) string {
+	if record != nil {
+		return record.Commandid
+	}
+	if matchslicesub := matchPattern(commandIDPattern, logline); matchslicesub != nil {
+		return matchslicesub[1]
+	}
+	return ""
+}
+
+// internal helper function to return how long a node was empty before emptiness consolidation, empty if absent
+func emptyDuration(record *karpenterlogline, logline string) string {
+	if record != nil {
+		return cmp.Or(record.Emptyduration, record.EmptyDuration)
+	}
+	if matchslicesub := matchPattern(emptydurationPattern, logline); matchslicesub != nil {
+		return matchslicesub[1]
+	}
+	return ""
+}
+
+// internal helper function to substitute "," in Karpenter lists because we output CSV finally
+// Karpenter provisioner.go prints the first 5 instance types or pods only and remaining number like "a, b, c, d, e and 55 other(s)"
+func pipeList(val string) string {
+	list, overflow := splitOverflow(val)
+	if overflow > 0 {
+		return fmt.Sprintf("%s|and%dothers", list, overflow)
+	}
+	return list
+}
+
+// internal helper function to split a Karpenter list like "a, b, c, d, e and 55 other(s)" into "a|b|c|d|e" and the number of omitted entries
+func splitOverflow(val string) (string, int) {
+	var overflow int
+	if matchslicesub := overflowPattern.FindStringSubmatchIndex(val); matchslicesub != nil {
+		overflow, _ = strconv.Atoi(val[matchslicesub[2]:matchslicesub[3]])
+		val = val[:matchslicesub[0]]
+	}
+	return replacer.Replace(val), overflow
+}
+
+// internal helper function to derive the instance family from an instance type
+// family is everything before the first "." i.e. "m5.2xlarge" -> "m5", "m7i.metal-24xl" -> "m7i", "u-6tb1.metal" -> "u-6tb1"
+func instanceFamily(instancetype string) string {
+	family, _, _ := strings.Cut(strings.TrimSpace(instancetype), ".")
+	return family
+}
+
+// internal helper function to print a parsed event as one line like "[12:01:03] launched default-abcde m5.large spot" to STDERR
+func (p *Parser) traceEvent(eventtime string, event string, nodeclaim string, details ...string) {
+	if !p.options.Trace {
+		return
+	}
+	if t, err := datetime.Parse(eventtime, time.UTC); err == nil {
+		eventtime = t.Format(time.TimeOnly)
+	}
+	fmt.Fprintf(os.Stderr, "[%s] %s\n", eventtime, strings.Join(append([]string{event, nodeclaim}, details...), " "))
+}
+
+// internal helper function to add or update annotation key:value in "|" separated, key sorted annotations of a nodeclaim
+// keys are unique, so repeated annotation events with the same key keep the latest value only
+func mergeAnnotation(annotations string, key string, value string) string {
+	annotationmap := make(map[string]string)
+	for annotation := range strings.SplitSeq(annotations, "|") {
+		if k, v, ok := strings.Cut(annotation, ":"); ok {
+			annotationmap[k] = v
+		}
+	}
+	annotationmap[key] = value
+	keys := make([]string, 0, len(annotationmap))
+	for k := range annotationmap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s:%s", k, annotationmap[k])
+	}
+	return strings.Join(keys, "|")
+}
+
+// internal helper function to alert on STDERR if node ready time of a nodeclaim exceeds LP4K_READY_SLA
+func (p *Parser) checkReadySLA(nodeclaim string, entry Nodeclaimstruct) {
+	if p.options.Readysla > 0 && entry.Nodereadytime > p.options.Readysla {
+		p.readyslabreaches.Add(1)
+		fmt.Fprintf(os.Stderr, "ALERT: nodeclaim \"%s\" (nodepool \"%s\", instance type \"%s\") took %s to become ready, exceeding SLA of %s\n", nodeclaim, entry.Nodepool, entry.Instancetype, entry.Nodereadytime, p.options.Readysla)
+	}
+}
+
+// ReadySLABreaches returns the number of nodeclaims parsed by p whose node ready time exceeded LP4K_READY_SLA so far
+func (p *Parser) ReadySLABreaches() int64 {
+	return p.readyslabreaches.Load()
+}
+
 // internal helper function for scanner error handling
 func scannerErr(scanner *bufio.Scanner, stdin string) {
 	// Ctrl-C will always lead to "http2: response body closed", so suppress this error
@@ -85,44 +536,165 @@ func scannerErr(scanner *bufio.Scanner, stdin string) {
 	}
 }
 
-// wrapper around main parsing logic with blocking
-func BlockingParser(ch chan os.Signal, scanner *bufio.Scanner, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, stdin string, inputline int) {
+// LineBudgetReached returns a channel which is closed once p parsed LP4K_MAX_LINES lines, it is never closed without LP4K_MAX_LINES
+func (p *Parser) LineBudgetReached() <-chan struct{} {
+	return p.linebudget
+}
+
+// internal helper function to count a parsed line, returns false for all lines beyond LP4K_MAX_LINES
+func (p *Parser) countLine() bool {
+	if p.options.Maxlines == 0 {
+		return true
+	}
+	switch n := p.parsedlines.Add(1); {
+	case n == p.options.Maxlines:
+		fmt.Fprintf(os.Stderr, "\nParsed %d lines of %s - stopping\n", n, maxlinesEnv)
+		close(p.linebudget)
+	case n > p.options.Maxlines:
+		return false
+	}
+	return true
+}
+
+// SetRecordSource enables recording of input file and line where a nodeclaim was created as Sourcefile and Sourceline by p
+// call it before p parses anything
+func (p *Parser) SetRecordSource(enabled bool) {
+	p.options.Recordsource = enabled
+}
+
+// wrapper around main parsing logic with blocking, inputline is the number of lines preceding the first scanned line
+func (p *Parser) BlockingParser(ch chan os.Signal, scanner *bufio.Scanner, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, stdin string, inputline int) {
 	// main parsing logic
 	for scanner.Scan() {
 		//logline := scanner.Text()
-		ParseKarpenterLogs(scanner.Text(), nodeclaimmap, k8snodenamemap, stdin, inputline)
+		inputline++
+		p.ParseKarpenterLogs(scanner.Text(), nodeclaimmap, k8snodenamemap, stdin, inputline)
 		// we wait until Ctrl-C because we have an input from something like "kubectl logs -n karpenter -l=app.kubernetes.io/name=karpenter -f"
 		go func() {
 			<-ch
 		}()
+		// stop reading STDIN once LP4K_MAX_LINES lines are parsed
+		select {
+		case <-p.linebudget:
+			return
+		default:
+		}
 	}
 	scannerErr(scanner, stdin)
 }
 
-// wrapper around main parsing logic without blocking
-func NonBlockingParser(scanner *bufio.Scanner, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, stdin string, inputline int) {
+// wrapper around main parsing logic without blocking, inputline is the number of lines preceding the first scanned line
+func (p *Parser) NonBlockingParser(scanner *bufio.Scanner, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, stdin string, inputline int) {
 	// main parsing logic
 	for scanner.Scan() {
 		//logline := scanner.Text()
-		ParseKarpenterLogs(scanner.Text(), nodeclaimmap, k8snodenamemap, stdin, inputline)
+		inputline++
+		p.ParseKarpenterLogs(scanner.Text(), nodeclaimmap, k8snodenamemap, stdin, inputline)
 	}
 	scannerErr(scanner, stdin)
 }
 
-// main parsing logic
-func ParseKarpenterLogs(logline string, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, filename string, inputline int) {
+// wrapper around main parsing logic without blocking for files, which continues with a new scanner after scanner errors
+// like lines exceeding the scanner buffer, so a single corrupt line does not truncate parsing of the rest of the file
+// with LP4K_FORMAT_DIRECTIVES=true leading directive lines set parsing hints for this file only
+func (p *Parser) ResilientParser(reader io.Reader, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, filename string, inputline int) {
+	defer func() { p.hints = formathints{} }()
+	leading := p.options.Formatdirectives
+	for {
+		scanner := bufio.NewScanner(reader)
+		var scanned bool
+		for scanner.Scan() {
+			scanned = true
+			inputline++
+			if leading && p.parseDirective(scanner.Text(), inputline, filename) {
+				continue
+			}
+			leading = false
+			p.ParseKarpenterLogs(scanner.Text(), nodeclaimmap, k8snodenamemap, filename, inputline)
+		}
+		scannerErr(scanner, filename)
+		// stop at EOF and on errors which repeat without any progress like I/O errors
+		if scanner.Err() == nil || (!scanned && !errors.Is(scanner.Err(), bufio.ErrTooLong)) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Continuing parsing %s after scanner error\n", filename)
+	}
+}
+
+// EventHandler is invoked for each parsed nodeclaim event with the Karpenter log message, the nodeclaim name and the updated nodeclaim
+type EventHandler func(msg string, name string, nc Nodeclaimstruct)
+
+// ParseFile parses the Karpenter log file filename with ResilientParser
+func (p *Parser) ParseFile(filename string, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	p.ResilientParser(file, nodeclaimmap, k8snodenamemap, filename, 0)
+	return nil
+}
+
+// main parsing logic, inputline is the line number of logline in filename
+// returns the name and updated entry of the nodeclaim of logline, an empty name if no nodeclaim was updated
+func (p *Parser) ParseKarpenterLogs(logline string, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, filename string, inputline int) (string, Nodeclaimstruct) {
+	_, name := p.parseKarpenterLogs(logline, nodeclaimmap, k8snodenamemap, filename, inputline)
+	return name, (*nodeclaimmap)[name]
+}
+
+// ParseKarpenterLogsWithHandler populates nodeclaimmap like ParseKarpenterLogs and additionally calls handler for every parsed nodeclaim event
+// this allows library users to build streaming pipelines without polling nodeclaimmap
+func (p *Parser) ParseKarpenterLogsWithHandler(logline string, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, filename string, inputline int, handler EventHandler) {
+	if msg, name := p.parseKarpenterLogs(logline, nodeclaimmap, k8snodenamemap, filename, inputline); name != "" {
+		handler(msg, name, (*nodeclaimmap)[name])
+	}
+}
+
+// internal main parsing logic, returns Karpenter log message and nodeclaim name if a nodeclaim was updated
+func (p *Parser) parseKarpenterLogs(logline string, nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string, filename string, inputline int) (string, string) {
 	var createdtime, nodepool, instancetypes, nodeclaim string
+	var instancetypesoverflow int
 	var matchslice []string
 
-	inputline++
-	matchslice = messagePattern.FindStringSubmatch(logline)
-	// process matchslice if we found a match
-	if matchslice != nil {
+	if !p.countLine() {
+		return "", ""
+	}
+	// profile unwrapping, decoding and matching as well, their time is attributed to the message once it is known
+	var message string
+	if p.options.Profile {
+		defer func(start time.Time) {
+			if message != "" {
+				p.profiling.profileMessage(message, start)
+			}
+		}(time.Now())
+	}
+	// unwrap Karpenter log line from "journalctl -o json" export records, unless a "#lp4k-format:" directive says otherwise
+	if p.hints.format == "journald" || (p.hints.format == "" && strings.Contains(logline, journaldTimestampKey)) {
+		logline = unwrapJournald(logline)
+	}
+	if p.options.Tolerant && !isKarpenterLogline(logline) {
+		return "", ""
+	}
+	// structured JSON loglines are decoded once into a typed record, legacy loglines are matched with regex patterns
+	record := decodeLogline(logline)
+	if record == nil {
+		matchslice = messagePattern.FindStringSubmatch(logline)
+	} else if record.Message != "" {
+		matchslice = []string{logline, record.Message}
+	}
+	// process matchslice if we found a match and message is not ignored via LP4K_IGNORE_MESSAGES
+	if matchslice != nil && !p.options.Ignoremessages[matchslice[1]] {
+		message = matchslice[1]
 		//fmt.Println("message: ", matchslice[1])
 		switch matchslice[1] {
 		case "created nodeclaim":
+			// skip nodeclaims of other nodepools cheaply without regex if LP4K_ONLY_NODEPOOL is set
+			// they are never tracked, so all subsequent messages for them are ignored as well
+			if p.options.Onlynodepool != "" && !strings.Contains(logline, p.onlynodepoolfragment) {
+				break
+			}
 			// extract time and nodeclaim (new one)
-			if matchslicesub := matchPattern(createdPattern, logline); matchslicesub != nil {
+			if matchslicesub := submatches(record, record.created, createdPattern.FindStringSubmatch, logline); matchslicesub != nil {
 				//matchslicesub[0] always contains whole logline
 				for i, val := range matchslicesub[1:] {
 					switch i {
@@ -133,97 +705,214 @@ func ParseKarpenterLogs(logline string, nodeclaimmap *map[string]Nodeclaimstruct
 					case 2:
 						nodeclaim = val
 					case 3:
-						// substitute "," because we output CSV finally
-						// Karpenter provisioner.go prints the first 5 instance types only and remaining number
-						if idx := strings.LastIndex(val, " and "); idx > 0 {
-							instancetypes = fmt.Sprintf("%s|%s", replacer.Replace(val[:idx]), replacer.Replace(val[idx:]))
-						} else {
-							instancetypes = replacer.Replace(val)
-						}
+						// combined created and launched log lines have launch details after instance types
+						val, _, _ = strings.Cut(val, `"`)
+						instancetypes, instancetypesoverflow = splitOverflow(val)
+					}
+				}
+				// the fragment may also match other keys of the logline, only the extracted nodepool is decisive
+				if p.options.Onlynodepool != "" && nodepool != p.options.Onlynodepool {
+					nodeclaim = ""
+					break
+				}
+				// a duplicate "created nodeclaim" line for a tracked, not yet deleted nodeclaim must not wipe already parsed data
+				if entry, ok := (*nodeclaimmap)[nodeclaim]; ok && !entry.Deleted {
+					fmt.Fprintf(os.Stderr, "Warning: nodeclaim \"%s\" created again in line %d in %s, keeping already parsed data\n", nodeclaim, inputline, filename)
+					logWarning(slog.LevelWarn, matchslice[1], "duplicate nodeclaim", logline, inputline, filename)
+					// the duplicate neither updates nor reports the tracked nodeclaim
+					nodeclaim = ""
+					break
+				} else if ok {
+					// nodeclaim name has been reused after deletion, keep the previous nodeclaim as versioned entry "name.2", "name.3", ...
+					versioned := versionedName(nodeclaimmap, nodeclaim)
+					(*nodeclaimmap)[versioned] = entry
+					// the K8s node of the previous nodeclaim belongs to the versioned entry, the reused name registers its own node later
+					if entry.K8snodename != "" && (*k8snodenamemap)[entry.K8snodename] == nodeclaim {
+						(*k8snodenamemap)[entry.K8snodename] = versioned
 					}
 				}
+				// only track nodeclaims of LP4K_NODECLAIM_LIST, all subsequent messages of other nodeclaims are ignored as well
+				if p.options.Nodeclaimlist != nil && !p.options.Nodeclaimlist[nodeclaim] {
+					break
+				}
+				requestedcpu, requestedmemory, requestedpods := requestedResources(record, logline)
 				// we only create a new nodeclaimmap map entry when we capture a "created nodeclaim" log line
 				// add entry to hash map
 				(*nodeclaimmap)[nodeclaim] = Nodeclaimstruct{
-					Createdtime:            createdtime,
-					Nodepool:               nodepool,
-					Instancetypes:          instancetypes,
-					Launchedtime:           "",
-					Providerid:             "",
-					Instancetype:           "",
-					Zone:                   "",
-					Capacitytype:           "",
-					Registeredtime:         "",
-					K8snodename:            "",
-					Initializedtime:        "",
-					Nodereadytime:          0,
-					Nodereadytimesec:       0.0,
-					Disruptiontime:         "",
-					Disruptionreason:       "",
-					Disruptiondecision:     "",
-					Disruptednodecount:     "",
-					Replacementnodecount:   "",
-					Disruptedpodcount:      "",
-					Annotationtime:         "",
-					Annotation:             "",
-					Tainttime:              "",
-					Taint:                  "",
-					Interruptionkind:       "",
-					Deletedtime:            "",
-					Nodeterminationtime:    0,
-					Nodeterminationtimesec: 0.0,
-					Nodelifecycletime:      0,
-					Nodelifecycletimesec:   0.0,
-					Initialized:            false,
-					Deleted:                false,
+					Createdtime:              createdtime,
+					Nodepool:                 nodepool,
+					Instancetypes:            instancetypes,
+					Instancetypesoverflow:    instancetypesoverflow,
+					Requestedcpu:             requestedcpu,
+					Requestedmemory:          requestedmemory,
+					Requestedpods:            requestedpods,
+					Launchedtime:             "",
+					Providerid:               "",
+					Instancetype:             "",
+					Instancefamily:           "",
+					Vcpus:                    0,
+					Memorymib:                0,
+					Arch:                     "",
+					Zone:                     "",
+					Capacitytype:             "",
+					Amiid:                    "",
+					Registeredtime:           "",
+					K8snodename:              "",
+					Registrationtimeoutsec:   0.0,
+					Initializedtime:          "",
+					Nodereadytime:            0,
+					Nodereadytimesec:         0.0,
+					Bootreadytime:            0,
+					Bootreadytimesec:         0.0,
+					Disruptiontime:           "",
+					Disruptionreason:         "",
+					Disruptiondecision:       "",
+					Disruptioncommandid:      "",
+					Disruptionblocked:        "",
+					Disruptednodecount:       "",
+					Replacementnodecount:     "",
+					Disruptedpodcount:        "",
+					Emptydurationsec:         0.0,
+					Annotationtime:           "",
+					Annotation:               "",
+					Disruptionannotationtime: "",
+					Tainttime:                "",
+					Taint:                    "",
+					Interruptionkind:         "",
+					Interruptioncategory:     "",
+					Deletedtime:              "",
+					Nodeterminationtime:      0,
+					Nodeterminationtimesec:   0.0,
+					Nodelifecycletime:        0,
+					Nodelifecycletimesec:     0.0,
+					Eventreasons:             "",
+					Maxloglevel:              "",
+					Initialized:              false,
+					Deleted:                  false,
+					Failedregistration:       false,
+					Spannedrestart:           false,
+					Sourcefile:               "",
+					Sourceline:               0,
+				}
+				if p.options.Recordsource {
+					entry := (*nodeclaimmap)[nodeclaim]
+					entry.Sourcefile = filename
+					entry.Sourceline = inputline
+					(*nodeclaimmap)[nodeclaim] = entry
+				}
+				p.traceEvent(createdtime, "created", nodeclaim, nodepool)
+				p.metrics.observeStage("created", (*nodeclaimmap)[nodeclaim])
+				// some Karpenter versions log creation and launch in one combined line without a separate "launched nodeclaim" line
+				if launchslice := submatches(record, record.combinedLaunch, combinedLaunchPattern.FindStringSubmatch, logline); launchslice != nil {
+					entry := (*nodeclaimmap)[nodeclaim]
+					entry.Launchedtime = createdtime
+					awsproviderID := strings.Split(launchslice[1], "/")
+					entry.Providerid = awsproviderID[len(awsproviderID)-1]
+					entry.Instancetype = launchslice[2]
+					entry.Instancefamily = instanceFamily(launchslice[2])
+					entry.Zone = launchslice[3]
+					entry.Capacitytype = launchslice[4]
+					entry.Amiid = amiID(record, logline)
+					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Launchedtime, "launched", nodeclaim, entry.Instancetype, entry.Capacitytype)
+					p.metrics.observeStage("launched", entry)
+				}
+				p.events.correlateProvisioningDecision(nodeclaim, logline)
+			} else {
+				parsingError(matchslice[1], "", logline, inputline, filename)
+			}
+		case "found provisionable pod(s)", "computed new nodeclaim(s) to fit pod(s)":
+			// cluster-level provisioning decisions, correlated with "created nodeclaim" by reconcileID
+			if !p.events.parseProvisioningEvent(matchslice[1], logline) {
+				parsingError(matchslice[1], "", logline, inputline, filename)
+			}
+		case "Starting metrics server":
+			// logged once on every Karpenter controller start, all nodeclaims alive at this point span a restart
+			if matchslicesub := matchPattern(restartPattern, logline); matchslicesub != nil {
+				p.events.recordRestart(matchslicesub[1])
+				for k, entry := range *nodeclaimmap {
+					if !entry.Deleted && !entry.Spannedrestart {
+						entry.Spannedrestart = true
+						(*nodeclaimmap)[k] = entry
+					}
 				}
+				p.traceEvent(matchslicesub[1], "restart", "karpenter")
 			} else {
-				fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+				parsingError(matchslice[1], "", logline, inputline, filename)
 			}
 		case "launched nodeclaim":
 			// extract all nodeclaim details here
-			if matchslicesub := matchPattern(launchedPattern, logline); matchslicesub != nil {
+			if matchslicesub := submatches(record, record.launched, launchedPattern.FindStringSubmatch, logline); matchslicesub != nil {
 				//matchslicesub[0] always contains whole logline
 				// if logline parsing went well, matchslicesub[2] will contain NodeClaim
 				if nodeclaim = matchslicesub[2]; nodeclaim == "" {
-					fmt.Fprintf(os.Stderr, "Parsing error empty \"NodeClaim\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
 				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 					//matchslice[0] always contains whole logline
 					entry.Launchedtime = matchslicesub[1]
 					awsproviderID := strings.Split(matchslicesub[3], "/")
 					entry.Providerid = awsproviderID[len(awsproviderID)-1]
 					entry.Instancetype = matchslicesub[4]
+					entry.Instancefamily = instanceFamily(matchslicesub[4])
 					entry.Zone = matchslicesub[5]
 					entry.Capacitytype = matchslicesub[6]
+					entry.Amiid = amiID(record, logline)
 					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Launchedtime, "launched", nodeclaim, entry.Instancetype, entry.Capacitytype)
+					p.metrics.observeStage("launched", entry)
 				}
 			} else {
-				fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+				parsingError(matchslice[1], "", logline, inputline, filename)
 			}
 		case "registered nodeclaim":
 			// extract time, nodeclaim and K8s node name
-			if matchslicesub := matchPattern(registeredPattern, logline); matchslicesub != nil {
+			if matchslicesub := submatches(record, record.registered, matchRegistered, logline); matchslicesub != nil {
 				//matchslicesub[0] always contains whole logline
 				// if logline parsing went well, matchslicesub[2] will contain NodeClaim
 				if nodeclaim = matchslicesub[2]; nodeclaim == "" {
-					fmt.Fprintf(os.Stderr, "Parsing error empty \"NodeClaim\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
 				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 					//matchslicesub[0] always contains whole logline
 					entry.Registeredtime = matchslicesub[1]
 					entry.K8snodename = matchslicesub[3]
 					(*k8snodenamemap)[matchslicesub[3]] = nodeclaim
 					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Registeredtime, "registered", nodeclaim, entry.K8snodename)
+					p.metrics.observeStage("registered", entry)
 				}
 			} else {
-				fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+				parsingError(matchslice[1], "", logline, inputline, filename)
+			}
+		case "terminating due to registration ttl", "nodeclaim not registered, terminating":
+			// node did not register within Karpenter's registration TTL, extract time and nodeclaim
+			if matchslicesub := submatches(record, record.nodeclaim, matchNodeclaim, logline); matchslicesub != nil {
+				if nodeclaim = matchslicesub[2]; nodeclaim == "" {
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
+				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
+					// measure the wait from launch, or from creation if the launch was not logged
+					start := entry.Launchedtime
+					if start == "" {
+						start = entry.Createdtime
+					}
+					if start != "" {
+						t1, _ := datetime.Parse(start, time.UTC)
+						t2, _ := datetime.Parse(matchslicesub[1], time.UTC)
+						entry.Registrationtimeoutsec = t2.Sub(t1).Seconds()
+					}
+					entry.Failedregistration = true
+					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(matchslicesub[1], "registrationtimeout", nodeclaim, strconv.FormatFloat(entry.Registrationtimeoutsec, 'f', -1, 64))
+				}
+			} else {
+				parsingError(matchslice[1], "", logline, inputline, filename)
 			}
 		case "initialized nodeclaim":
 			// extract time and nodeclaim
-			if matchslicesub := matchPattern(initializedPattern, logline); matchslicesub != nil {
+			if matchslicesub := submatches(record, record.nodeclaim, initializedPattern.FindStringSubmatch, logline); matchslicesub != nil {
 				//matchslicesub[0] always contains whole logline
 				// if logline parsing went well, matchslicesub[2] will contain NodeClaim
 				if nodeclaim = matchslicesub[2]; nodeclaim == "" {
-					fmt.Fprintf(os.Stderr, "Parsing error empty \"NodeClaim\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
 				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 					//matchslicesub[0] always contains whole logline
 					if entry.Initializedtime = matchslicesub[1]; entry.Initializedtime != "" {
@@ -233,29 +922,36 @@ func ParseKarpenterLogs(logline string, nodeclaimmap *map[string]Nodeclaimstruct
 							t2, _ := datetime.Parse(entry.Initializedtime, time.UTC)
 							entry.Nodereadytime = t2.Sub(t1)
 							entry.Nodereadytimesec = entry.Nodereadytime.Seconds()
+							p.checkReadySLA(nodeclaim, entry)
+							p.readyquantiles.observeNodeready(entry.Nodereadytimesec)
+						}
+						// calculate instance boot time without scheduling and launch latency
+						if entry.Launchedtime != "" {
+							t1, _ := datetime.Parse(entry.Launchedtime, time.UTC)
+							t2, _ := datetime.Parse(entry.Initializedtime, time.UTC)
+							entry.Bootreadytime = t2.Sub(t1)
+							entry.Bootreadytimesec = entry.Bootreadytime.Seconds()
 						}
 					} else {
-						fmt.Fprintf(os.Stderr, "Parsing error empty \"initialized time\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+						parsingError(matchslice[1], "initialized time", logline, inputline, filename)
 					}
 					// we set nodeclaim to deleted even if we (for whatever reason) could not extract time
 					entry.Initialized = true
 					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Initializedtime, "initialized", nodeclaim, entry.Nodereadytime.String())
+					p.metrics.observeStage("initialized", entry)
 				}
 			} else {
-				fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+				parsingError(matchslice[1], "", logline, inputline, filename)
 			}
 		case "disrupting node(s)":
 			// extract time, message reason/command, decision, disrupted-node-count, replacment-node-count, podcount and nodeclaim
-			var matchslicesub []string
-			var isCommandField bool
-			if matchslicesub = matchPattern(disruptingReasonPattern, logline); matchslicesub != nil {
-				isCommandField = false
-			} else if matchslicesub = matchPattern(disruptingCommandPattern, logline); matchslicesub != nil {
-				isCommandField = true
-			}
+			// Karpenter versions log either the disruption reason or the disruption command
+			matchslicesub, version := p.versionedSubmatches(record, record.disrupting, disruptingPatterns, disruptingSince, logline)
+			isCommandField := version == 1
 			if matchslicesub != nil {
 				if nodeclaim = matchslicesub[7]; nodeclaim == "" {
-					fmt.Fprintf(os.Stderr, "Parsing error empty \"NodeClaim\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
 				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 					entry.Disruptiontime = matchslicesub[1]
 					if isCommandField {
@@ -269,92 +965,106 @@ func ParseKarpenterLogs(logline string, nodeclaimmap *map[string]Nodeclaimstruct
 					entry.Disruptednodecount = matchslicesub[4]
 					entry.Replacementnodecount = matchslicesub[5]
 					entry.Disruptedpodcount = matchslicesub[6]
+					// emptiness consolidation may log how long the node was empty, older and newer Karpenter versions omit it
+					if emptyduration, err := time.ParseDuration(emptyDuration(record, logline)); err == nil {
+						entry.Emptydurationsec = emptyduration.Seconds()
+					}
 					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Disruptiontime, "disrupting", nodeclaim, entry.Disruptionreason, entry.Disruptiondecision)
 				}
 			} else {
-				fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+				parsingError(matchslice[1], "", logline, inputline, filename)
 			}
 		case "initiating delete from interruption message":
 			// extract time, message kind (interruption kind/reason) and nodeclaim (this message kind has NodeClaim in a different position!)
-			if matchslicesub := matchPattern(interruptionPattern, logline); matchslicesub != nil {
+			if matchslicesub := submatches(record, record.interruption, interruptionPattern.FindStringSubmatch, logline); matchslicesub != nil {
 				//matchslicesub[0] always contains whole logline
 				// if logline parsing went well, matchslicesub[3] will contain NodeClaim
 				if nodeclaim = matchslicesub[3]; nodeclaim == "" {
-					fmt.Fprintf(os.Stderr, "Parsing error empty \"NodeClaim\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
 				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 					entry.Interruptiontime = matchslicesub[1]
 					entry.Interruptionkind = matchslicesub[2]
+					entry.Interruptioncategory = interruptionCategory(entry.Interruptionkind)
 					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Interruptiontime, "interrupted", nodeclaim, entry.Interruptionkind)
 				}
 			} else {
-				fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+				parsingError(matchslice[1], "", logline, inputline, filename)
 			}
 		case "annotated nodeclaim":
 			// extract time, nodeclaim and annotation key/value
-			if matchslicesub := matchPattern(annotatedPattern, logline); matchslicesub != nil {
+			if matchslicesub := submatches(record, func() []string { return record.annotated(logline) }, annotatedPattern.FindStringSubmatch, logline); matchslicesub != nil {
 				//matchslicesub[0] always contains whole logline
 				// if logline parsing went well, matchslicesub[2] will contain NodeClaim
 				if nodeclaim = matchslicesub[2]; nodeclaim == "" {
-					fmt.Fprintf(os.Stderr, "Parsing error empty \"NodeClaim\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
 				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 					entry.Annotationtime = matchslicesub[1]
-					entry.Annotation = fmt.Sprintf("%s:%s", matchslicesub[3], matchslicesub[4])
+					entry.Annotation = mergeAnnotation(entry.Annotation, matchslicesub[3], matchslicesub[4])
+					// later unrelated annotations must not move the start of the disruption lifecycle
+					if p.options.Disruptionannotations[matchslicesub[3]] && entry.Disruptionannotationtime == "" {
+						entry.Disruptionannotationtime = matchslicesub[1]
+					}
 					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Annotationtime, "annotated", nodeclaim, entry.Annotation)
 				}
 			} else {
-				fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+				parsingError(matchslice[1], "", logline, inputline, filename)
 			}
 		case "tainted node":
-			// extract time, nodeclaim and taint key/value/effect for Karpenter version 1.1.x+
-			if matchslicesub := matchPattern(taintedNCPattern, logline); matchslicesub != nil {
-				//matchslicesub[0] always contains whole logline
+			// Karpenter version 1.1.x+ logs nodeclaim and taint, 1.0.x K8s node name and taint, 0.37.x K8s node name only
+			matchslicesub, version := p.versionedSubmatches(record, record.tainted, taintedPatterns, taintedSince, logline)
+			switch version {
+			case 0:
+				// extract time, nodeclaim and taint key/value/effect for Karpenter version 1.1.x+
 				// if logline parsing went well, matchslicesub[2] will contain NodeClaim
 				if nodeclaim = matchslicesub[2]; nodeclaim == "" {
-					fmt.Fprintf(os.Stderr, "Parsing error empty \"NodeClaim\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
 				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 					entry.Tainttime = matchslicesub[1]
 					entry.Taint = fmt.Sprintf("%s:%s:%s", matchslicesub[3], matchslicesub[4], matchslicesub[5])
 					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Tainttime, "tainted", nodeclaim, entry.Taint)
 				}
-			} else {
-				// Karpenter version 0.37.x and 1.0.x don't put nodeclaim into "tainted node" message !
+			case 1:
 				// extract time, k8snodename taint key/value/effect for Karpenter version 1.0.x
-				if matchslicesub := matchPattern(taintedNodePattern, logline); matchslicesub != nil {
-					// if logline parsing went well, matchslicesub[2] will contain K8s node name
-					if k8snodename := matchslicesub[2]; k8snodename == "" {
-						fmt.Fprintf(os.Stderr, "Parsing error empty \"K8s node name\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
-					} else if nodeclaim, ok := (*k8snodenamemap)[k8snodename]; ok {
+				// if logline parsing went well, matchslicesub[2] will contain K8s node name
+				if k8snodename := matchslicesub[2]; k8snodename == "" {
+					parsingError(matchslice[1], "K8s node name", logline, inputline, filename)
+				} else if nodeclaim = (*k8snodenamemap)[k8snodename]; nodeclaim != "" {
+					if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
+						entry.Tainttime = matchslicesub[1]
+						entry.Taint = fmt.Sprintf("%s:%s:%s", matchslicesub[3], matchslicesub[4], matchslicesub[5])
+						(*nodeclaimmap)[nodeclaim] = entry
+						p.traceEvent(entry.Tainttime, "tainted", nodeclaim, entry.Taint)
+					}
+				} else {
+					fmt.Fprintf(os.Stderr, "No corresponding \"NodeClaim\" for K8s node \"%s\" for message \"tainted node\" in line %d in %s\n", k8snodename, inputline, filename)
+					fmt.Fprintf(os.Stderr, "Most probably %s does not contain a corresponding \"created nodeclaim\" log entry\n", filename)
+					logWarning(slog.LevelWarn, matchslice[1], "unknown K8s node", logline, inputline, filename)
+				}
+			case 2:
+				// extract time and k8snodename for Karpenter version 0.37.x
+				if k8snodename := matchslicesub[2]; k8snodename != "" {
+					if nodeclaim = (*k8snodenamemap)[k8snodename]; nodeclaim != "" {
 						if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 							entry.Tainttime = matchslicesub[1]
-							entry.Taint = fmt.Sprintf("%s:%s:%s", matchslicesub[3], matchslicesub[4], matchslicesub[5])
 							(*nodeclaimmap)[nodeclaim] = entry
-						}
-					} else {
-						fmt.Fprintf(os.Stderr, "No corresponding \"NodeClaim\" for K8s node \"%s\" for message \"tainted node\" in line %d in %s\n", k8snodename, inputline, filename)
-						fmt.Fprintf(os.Stderr, "Most probably %s does not contain a corresponding \"created nodeclaim\" log entry\n", filename)
-					}
-				} else if matchslicesub := matchPattern(taintedNodeSimplePattern, logline); matchslicesub != nil {
-					// Karpenter version 0.37.x don't put taint key/value/effect into "tainted node" message !
-					// extract time and k8snodename for Karpenter version 0.37
-					if k8snodename := matchslicesub[2]; k8snodename != "" {
-						if nodeclaim, ok := (*k8snodenamemap)[k8snodename]; ok {
-							if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
-								entry.Tainttime = matchslicesub[1]
-								(*nodeclaimmap)[nodeclaim] = entry
-							}
+							p.traceEvent(entry.Tainttime, "tainted", nodeclaim)
 						}
 					}
-				} else {
-					fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
 				}
+			default:
+				parsingError(matchslice[1], "", logline, inputline, filename)
 			}
 		case "deleted nodeclaim":
 			// extract time and nodeclaim
-			if matchslicesub := matchPattern(deletedPattern, logline); matchslicesub != nil {
+			if matchslicesub := submatches(record, record.nodeclaim, deletedPattern.FindStringSubmatch, logline); matchslicesub != nil {
 				//matchslicesub[0] always contains whole logline
 				// if logline parsing went well, matchslicesub[2] will contain NodeClaim
 				if nodeclaim = matchslicesub[2]; nodeclaim == "" {
-					fmt.Fprintf(os.Stderr, "Parsing error empty \"NodeClaim\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+					parsingError(matchslice[1], "NodeClaim", logline, inputline, filename)
 				} else if entry, ok := (*nodeclaimmap)[nodeclaim]; ok {
 					//matchslicesub[0] always contains whole logline
 					if entry.Deletedtime = matchslicesub[1]; entry.Deletedtime != "" {
@@ -365,24 +1075,54 @@ func ParseKarpenterLogs(logline string, nodeclaimmap *map[string]Nodeclaimstruct
 							entry.Nodelifecycletime = t2.Sub(t1)
 							entry.Nodelifecycletimesec = entry.Nodelifecycletime.Seconds()
 						}
-						// calculate node termination time (time it takes from lifecycle annotation to actual deletion)
+						// calculate node termination time (time it takes from disruption lifecycle annotation to actual deletion)
 						// if this takes really long you might have some blocking PDB or taints
-						if entry.Annotationtime != "" {
-							t1, _ := datetime.Parse(entry.Annotationtime, time.UTC)
+						if entry.Disruptionannotationtime != "" {
+							t1, _ := datetime.Parse(entry.Disruptionannotationtime, time.UTC)
 							t2, _ := datetime.Parse(entry.Deletedtime, time.UTC)
 							entry.Nodeterminationtime = t2.Sub(t1)
 							entry.Nodeterminationtimesec = entry.Nodeterminationtime.Seconds()
 						}
 					} else {
-						fmt.Fprintf(os.Stderr, "Parsing error empty \"deleted time\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+						parsingError(matchslice[1], "deleted time", logline, inputline, filename)
 					}
 					// we set nodeclaim to deleted even if we (for whatever reason) could not extract time
 					entry.Deleted = true
 					(*nodeclaimmap)[nodeclaim] = entry
+					p.traceEvent(entry.Deletedtime, "deleted", nodeclaim, entry.Nodelifecycletime.String())
+					p.metrics.observeStage("deleted", entry)
 				}
 			} else {
-				fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", matchslice[1], inputline, filename)
+				parsingError(matchslice[1], "", logline, inputline, filename)
+			}
+		default:
+			// cluster-level disruption blocked by budgets or PDBs, a blocked candidate nodeclaim is flagged if logged
+			if isDisruptionBlocked(matchslice[1]) {
+				block := p.events.recordDisruptionBlock(matchslice[1], logline)
+				if matchslicesub := submatches(record, record.nodeclaim, matchNodeclaim, logline); matchslicesub != nil {
+					if entry, ok := (*nodeclaimmap)[matchslicesub[2]]; ok {
+						nodeclaim = matchslicesub[2]
+						entry.Disruptionblocked = strings.ReplaceAll(block.Reason, ",", ";")
+						(*nodeclaimmap)[nodeclaim] = entry
+					}
+				}
+				p.traceEvent(block.Time, "disruptionblocked", block.Nodepool, block.Reason)
+			}
+		}
+		if entry, ok := (*nodeclaimmap)[nodeclaim]; ok && nodeclaim != "" {
+			// record most severe log level of all handled messages of a nodeclaim, so nodeclaims with WARN or ERROR events can be filtered
+			if level := logLevel(record, logline); level != "" {
+				entry.Maxloglevel = maxLoglevel(entry.Maxloglevel, strings.ToUpper(level))
+				(*nodeclaimmap)[nodeclaim] = entry
+			}
+			// disruption command ID links disruption decision, taint and deletion of all nodeclaims of one disruption command
+			if commandid := commandID(record, logline); commandid != "" {
+				entry = (*nodeclaimmap)[nodeclaim]
+				entry.Disruptioncommandid = commandid
+				(*nodeclaimmap)[nodeclaim] = entry
 			}
+			return matchslice[1], nodeclaim
 		}
 	}
+	return "", ""
 }
@@ -0,0 +1,375 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseMixedVersions(t *testing.T) {
+	file, err := os.Open("../sample-input-mixed.txt")
+	if err != nil {
+		t.Fatalf("failed to open mixed version sample input: %v", err)
+	}
+	defer file.Close()
+	nodeclaimmap := make(map[string]Nodeclaimstruct)
+	k8snodenamemap := make(map[string]string)
+	NewParserWithOptions(Options{}).NonBlockingParser(bufio.NewScanner(file), &nodeclaimmap, &k8snodenamemap, "sample-input-mixed.txt", 0)
+
+	// default-v10ab is logged in Karpenter 1.0.x format, default-v11cd in 1.1.x format
+	for name, reason := range map[string]string{"default-v10ab": "underutilized", "default-v11cd": "empty"} {
+		entry, ok := nodeclaimmap[name]
+		if !ok {
+			t.Fatalf("nodeclaim %s not parsed", name)
+		}
+		if entry.K8snodename == "" || !entry.Initialized || !entry.Deleted {
+			t.Errorf("nodeclaim %s: incomplete lifecycle %+v", name, entry)
+		}
+		if entry.Disruptionreason != reason {
+			t.Errorf("nodeclaim %s: expected disruption reason %q, got %q", name, reason, entry.Disruptionreason)
+		}
+		if entry.Taint != "karpenter.sh/disrupted::NoSchedule" {
+			t.Errorf("nodeclaim %s: expected disrupted taint, got %q", name, entry.Taint)
+		}
+	}
+}
+
+func TestInterruptionCategory(t *testing.T) {
+	for kind, category := range map[string]string{
+		"spot_interrupted":         "spot-interruption",
+		"SpotInterruption":         "spot-interruption",
+		"rebalance_recommendation": "rebalance-recommendation",
+		"scheduled_change":         "scheduled-maintenance",
+		"state_change":             "instance-stopped",
+		"capacity_reserved":        "capacity_reserved",
+	} {
+		if got := interruptionCategory(kind); got != category {
+			t.Errorf("interruptionCategory(%q) = %q, expected %q", kind, got, category)
+		}
+	}
+}
+
+func TestParseDisruptionBlocked(t *testing.T) {
+	p := NewParserWithOptions(Options{})
+	nodeclaimmap := map[string]Nodeclaimstruct{"default-abcde": {Createdtime: "2025-04-23T15:00:00.000Z", Nodepool: "default"}}
+	k8snodenamemap := make(map[string]string)
+	for i, logline := range []string{
+		`{"level":"DEBUG","time":"2025-04-23T16:00:00.000Z","logger":"controller","message":"disruption blocked by budget","commit":"0871602","controller":"disruption","NodePool":{"name":"default"},"reason":"underutilized"}`,
+		`{"level":"DEBUG","time":"2025-04-23T16:01:00.000Z","logger":"controller","message":"pdb prevents pod evictions, disruption blocked","commit":"0871602","controller":"disruption","NodePool":{"name":"default"},"NodeClaim":{"name":"default-abcde"}}`,
+		`{"level":"INFO","time":"2025-04-23T16:02:00.000Z","logger":"controller","message":"deleted nodeclaim","commit":"0871602","controller":"nodeclaim.termination","NodeClaim":{"name":"default-fghij"},"namespace":""}`,
+	} {
+		p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "test", i+1)
+	}
+	blocks := p.DisruptionBlocks()
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocked disruptions, got %v", blocks)
+	}
+	if blocks[0] != (Disruptionblock{Time: "2025-04-23T16:00:00.000Z", Nodepool: "default", Reason: "underutilized"}) {
+		t.Errorf("unexpected blocked disruption %+v", blocks[0])
+	}
+	if got := nodeclaimmap["default-abcde"].Disruptionblocked; got != "pdb prevents pod evictions; disruption blocked" {
+		t.Errorf("expected blocked candidate nodeclaim, got Disruptionblocked %q", got)
+	}
+}
+
+func TestParseAmiid(t *testing.T) {
+	p := NewParserWithOptions(Options{})
+	nodeclaimmap := map[string]Nodeclaimstruct{"default-abcde": {}, "default-fghij": {}}
+	k8snodenamemap := make(map[string]string)
+	for i, logline := range []string{
+		`{"level":"INFO","time":"2025-04-23T15:06:01.559Z","logger":"controller","message":"launched nodeclaim","commit":"0871602","controller":"nodeclaim.lifecycle","NodeClaim":{"name":"default-abcde"},"namespace":"","provider-id":"aws:///eu-west-1a/i-0a6d418e61f97520c","instance-type":"i3.large","zone":"eu-west-1a","capacity-type":"spot","image-id":"ami-0123456789abcdef0","allocatable":{"cpu":"1930m"}}`,
+		`{"level":"INFO","time":"2025-04-23T15:06:01.559Z","logger":"controller","message":"launched nodeclaim","commit":"0871602","controller":"nodeclaim.lifecycle","NodeClaim":{"name":"default-fghij"},"namespace":"","provider-id":"aws:///eu-west-1a/i-0b6d418e61f97520c","instance-type":"i3.large","zone":"eu-west-1a","capacity-type":"spot","allocatable":{"cpu":"1930m"}}`,
+	} {
+		p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "test", i+1)
+	}
+	if got := nodeclaimmap["default-abcde"].Amiid; got != "ami-0123456789abcdef0" {
+		t.Errorf("expected Amiid ami-0123456789abcdef0, got %q", got)
+	}
+	if got := nodeclaimmap["default-fghij"]; got.Amiid != "" || got.Instancetype != "i3.large" {
+		t.Errorf("expected launched nodeclaim without Amiid, got %+v", got)
+	}
+}
+
+func TestParseStructuredLogline(t *testing.T) {
+	p := NewParserWithOptions(Options{})
+	nodeclaimmap := map[string]Nodeclaimstruct{"default-abcde": {}, "default-fghij": {}}
+	k8snodenamemap := make(map[string]string)
+	for i, logline := range []string{
+		// keys in a different order and without "allocatable", which only structured decoding parses
+		`{"time":"2025-04-23T15:06:01.559Z","level":"INFO","message":"launched nodeclaim","logger":"controller","capacity-type":"spot","zone":"eu-west-1a","instance-type":"i3.large","provider-id":"aws:///eu-west-1a/i-0a6d418e61f97520c","NodeClaim":{"name":"default-abcde"}}`,
+		// legacy logline with prefix, which is no JSON object and parsed with regex patterns
+		`karpenter-0 {"level":"INFO","time":"2025-04-23T15:06:02.559Z","logger":"controller","message":"launched nodeclaim","commit":"0871602","controller":"nodeclaim.lifecycle","NodeClaim":{"name":"default-fghij"},"namespace":"","provider-id":"aws:///eu-west-1b/i-0b6d418e61f97520c","instance-type":"m5.large","zone":"eu-west-1b","capacity-type":"on-demand","allocatable":{"cpu":"1930m"}}`,
+	} {
+		// the updated nodeclaim is returned as well
+		if name, nc := p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "test", i+1); nc != nodeclaimmap[name] || nc.Instancetype == "" {
+			t.Errorf("expected updated nodeclaim %q to be returned, got %+v", name, nc)
+		}
+	}
+	if got := nodeclaimmap["default-abcde"]; got.Providerid != "i-0a6d418e61f97520c" || got.Zone != "eu-west-1a" || got.Capacitytype != "spot" || got.Maxloglevel != "INFO" {
+		t.Errorf("unexpected structured launch %+v", got)
+	}
+	if got := nodeclaimmap["default-fghij"]; got.Providerid != "i-0b6d418e61f97520c" || got.Instancetype != "m5.large" || got.Capacitytype != "on-demand" {
+		t.Errorf("unexpected legacy launch %+v", got)
+	}
+}
+
+func TestParseDuplicateCreated(t *testing.T) {
+	p := NewParserWithOptions(Options{})
+	created := `{"level":"INFO","time":"2025-04-23T15:05:58.670Z","logger":"controller","message":"created nodeclaim","commit":"0871602","controller":"provisioner","NodePool":{"name":"default"},"NodeClaim":{"name":"default-abcde"},"requests":{"cpu":"1510m"},"instance-types":"c5ad.xlarge"}`
+	launched := `{"level":"INFO","time":"2025-04-23T15:06:01.559Z","logger":"controller","message":"launched nodeclaim","commit":"0871602","controller":"nodeclaim.lifecycle","NodeClaim":{"name":"default-abcde"},"namespace":"","provider-id":"aws:///eu-west-1a/i-0a6d418e61f97520c","instance-type":"c5ad.xlarge","zone":"eu-west-1a","capacity-type":"spot"}`
+	deleted := `{"level":"INFO","time":"2025-04-23T15:10:48.448Z","logger":"controller","message":"deleted nodeclaim","commit":"0871602","controller":"nodeclaim.lifecycle","NodeClaim":{"name":"default-abcde"},"namespace":"","provider-id":"aws:///eu-west-1a/i-0a6d418e61f97520c","Node":{"name":"ip-10-0-15-108.eu-west-1.compute.internal"}}`
+
+	// a duplicate "created nodeclaim" of a tracked nodeclaim keeps its data and is not reported as event
+	nodeclaimmap := make(map[string]Nodeclaimstruct)
+	k8snodenamemap := make(map[string]string)
+	var events []string
+	for i, logline := range []string{created, launched, created} {
+		p.ParseKarpenterLogsWithHandler(logline, &nodeclaimmap, &k8snodenamemap, "test", i+1, func(msg string, name string, nc Nodeclaimstruct) {
+			events = append(events, msg)
+		})
+	}
+	if got := nodeclaimmap["default-abcde"].Launchedtime; got != "2025-04-23T15:06:01.559Z" {
+		t.Errorf("expected Launchedtime to be kept, got %q", got)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected created and launched events only, got %v", events)
+	}
+
+	// a nodeclaim name reused after deletion keeps the deleted nodeclaim as versioned entry
+	nodeclaimmap = make(map[string]Nodeclaimstruct)
+	for i, logline := range []string{created, deleted, created} {
+		p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "test", i+1)
+	}
+	if got, ok := nodeclaimmap["default-abcde.2"]; !ok || !got.Deleted {
+		t.Errorf("expected deleted nodeclaim as default-abcde.2, got %+v", got)
+	}
+	if got := nodeclaimmap["default-abcde"]; got.Deleted || got.Createdtime == "" {
+		t.Errorf("expected newly created nodeclaim default-abcde, got %+v", got)
+	}
+
+	// a K8s node of the deleted nodeclaim is correlated with the versioned entry, not with the reused name
+	registered := `{"level":"INFO","time":"2025-04-23T15:06:31.730Z","logger":"controller","message":"registered nodeclaim","commit":"0871602","controller":"nodeclaim.lifecycle","NodeClaim":{"name":"default-abcde"},"namespace":"","provider-id":"aws:///eu-west-1a/i-0a6d418e61f97520c","Node":{"name":"ip-10-0-15-108.eu-west-1.compute.internal"}}`
+	tainted := `{"level":"INFO","time":"2025-04-23T15:11:02.000Z","logger":"controller","message":"tainted node","commit":"0871602","controller":"node.termination","Node":{"name":"ip-10-0-15-108.eu-west-1.compute.internal"},"namespace":"","name":"ip-10-0-15-108.eu-west-1.compute.internal","taint.Key":"karpenter.sh/disrupted","taint.Value":"","taint.Effect":"NoSchedule"}`
+	nodeclaimmap = make(map[string]Nodeclaimstruct)
+	k8snodenamemap = make(map[string]string)
+	for i, logline := range []string{created, registered, deleted, created, tainted} {
+		p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "test", i+1)
+	}
+	if got := k8snodenamemap["ip-10-0-15-108.eu-west-1.compute.internal"]; got != "default-abcde.2" {
+		t.Errorf("expected K8s node mapped to default-abcde.2, got %q", got)
+	}
+	if got := nodeclaimmap["default-abcde.2"].Tainttime; got != "2025-04-23T15:11:02.000Z" {
+		t.Errorf("expected Tainttime of default-abcde.2, got %q", got)
+	}
+	if got := nodeclaimmap["default-abcde"].Tainttime; got != "" {
+		t.Errorf("expected no Tainttime of newly created nodeclaim default-abcde, got %q", got)
+	}
+}
+
+func TestParseOnlyNodepool(t *testing.T) {
+	p := NewParserWithOptions(Options{Onlynodepool: "default"})
+	nodeclaimmap := make(map[string]Nodeclaimstruct)
+	k8snodenamemap := make(map[string]string)
+	for i, logline := range []string{
+		`{"level":"INFO","time":"2025-04-23T15:05:58.670Z","logger":"controller","message":"created nodeclaim","commit":"0871602","controller":"provisioner","NodePool":{"name":"default"},"NodeClaim":{"name":"default-abcde"},"requests":{"cpu":"1510m"},"instance-types":"c5ad.xlarge"}`,
+		// the fragment of nodepool "default" in another key must not track a nodeclaim of nodepool "gpu"
+		`{"level":"INFO","time":"2025-04-23T15:05:58.670Z","logger":"controller","message":"created nodeclaim","commit":"0871602","controller":"provisioner","NodePool":{"name":"gpu"},"NodeClaim":{"name":"gpu-fghij"},"fallback":{"NodePool":{"name":"default"}},"requests":{"cpu":"1510m"},"instance-types":"g5.xlarge"}`,
+		`{"level":"INFO","time":"2025-04-23T15:05:58.670Z","logger":"controller","message":"created nodeclaim","commit":"0871602","controller":"provisioner","NodePool":{"name":"default-gpu"},"NodeClaim":{"name":"default-gpu-klmno"},"requests":{"cpu":"1510m"},"instance-types":"g5.xlarge"}`,
+	} {
+		p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "test", i+1)
+	}
+	if _, ok := nodeclaimmap["default-abcde"]; !ok || len(nodeclaimmap) != 1 {
+		t.Errorf("expected only nodeclaim default-abcde of nodepool default, got %v", slices.Sorted(maps.Keys(nodeclaimmap)))
+	}
+}
+
+func TestParserOptions(t *testing.T) {
+	loglines := []string{
+		`{"level":"INFO","time":"2025-04-23T15:05:58.670Z","logger":"controller","message":"created nodeclaim","commit":"0871602","controller":"provisioner","NodePool":{"name":"default"},"NodeClaim":{"name":"default-abcde"},"requests":{"cpu":"1510m"},"instance-types":"c5ad.xlarge"}`,
+		`{"level":"INFO","time":"2025-04-23T15:05:58.670Z","logger":"controller","message":"created nodeclaim","commit":"0871602","controller":"provisioner","NodePool":{"name":"default"},"NodeClaim":{"name":"default-fghij"},"requests":{"cpu":"1510m"},"instance-types":"c5ad.xlarge"}`,
+	}
+	for _, tc := range []struct {
+		name    string
+		options Options
+		want    map[string]Nodeclaimstruct
+	}{
+		{"ignoremessages", Options{Ignoremessages: map[string]bool{"created nodeclaim": true}}, map[string]Nodeclaimstruct{}},
+		{"nodeclaimlist", Options{Nodeclaimlist: map[string]bool{"default-fghij": true}}, map[string]Nodeclaimstruct{"default-fghij": {Sourceline: 0}}},
+		{"recordsource", Options{Recordsource: true}, map[string]Nodeclaimstruct{"default-abcde": {Sourceline: 1}, "default-fghij": {Sourceline: 2}}},
+		{"maxlines", Options{Maxlines: 1}, map[string]Nodeclaimstruct{"default-abcde": {Sourceline: 0}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewParserWithOptions(tc.options)
+			nodeclaimmap := make(map[string]Nodeclaimstruct)
+			k8snodenamemap := make(map[string]string)
+			for i, logline := range loglines {
+				p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "test", i+1)
+			}
+			if len(nodeclaimmap) != len(tc.want) {
+				t.Fatalf("expected nodeclaims %v, got %v", slices.Sorted(maps.Keys(tc.want)), slices.Sorted(maps.Keys(nodeclaimmap)))
+			}
+			for name, want := range tc.want {
+				if got, ok := nodeclaimmap[name]; !ok || got.Sourceline != want.Sourceline {
+					t.Errorf("expected nodeclaim %s with Sourceline %d, got %+v", name, want.Sourceline, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	file, err := os.Open("../sample-input-mixed.txt")
+	if err != nil {
+		t.Fatalf("failed to open mixed version sample input: %v", err)
+	}
+	defer file.Close()
+	nodeclaimmap := make(map[string]Nodeclaimstruct)
+	k8snodenamemap := make(map[string]string)
+	p := NewParserWithOptions(Options{})
+	p.NonBlockingParser(bufio.NewScanner(file), &nodeclaimmap, &k8snodenamemap, "sample-input-mixed.txt", 0)
+
+	var metrics strings.Builder
+	p.WriteMetrics(&metrics)
+	for _, line := range []string{
+		"# TYPE lp4k_nodeclaim_ready_seconds histogram",
+		"# TYPE lp4k_nodeclaim_termination_seconds histogram",
+		`lp4k_nodeclaim_ready_seconds_bucket{nodepool="default",capacity_type="on-demand",le="+Inf"} 2`,
+		`lp4k_nodeclaims_created_total{nodepool="default"} 2`,
+		`lp4k_nodeclaims_total{nodepool="default",capacity_type="on-demand",stage="launched"} 2`,
+		`lp4k_nodeclaims_total{nodepool="default",capacity_type="on-demand",stage="deleted"} 2`,
+	} {
+		if !strings.Contains(metrics.String(), line+"\n") {
+			t.Errorf("expected metrics line %q in\n%s", line, metrics.String())
+		}
+	}
+	if strings.Contains(metrics.String(), `capacity_type="",stage=`) {
+		t.Errorf("expected no nodeclaim counter without capacity type in\n%s", metrics.String())
+	}
+}
+
+func TestSynchronizedParser(t *testing.T) {
+	// concurrent streams and a concurrent reader like the sink loop must not race, run with -race
+	p := NewParserWithOptions(Options{})
+	nodeclaimmap := make(map[string]Nodeclaimstruct)
+	store := NewNodeclaimstore(&nodeclaimmap, &map[string]string{})
+	var wg sync.WaitGroup
+	for stream := range 4 {
+		var loglines strings.Builder
+		for i := range 50 {
+			fmt.Fprintf(&loglines, `{"level":"INFO","time":"2025-04-23T15:05:58.670Z","logger":"controller","message":"created nodeclaim","commit":"0871602","controller":"provisioner","NodePool":{"name":"default"},"NodeClaim":{"name":"default-s%di%d"},"requests":{"cpu":"1510m"},"instance-types":"c5ad.xlarge"}`+"\n", stream, i)
+		}
+		wg.Go(func() {
+			p.SynchronizedParser(bufio.NewScanner(strings.NewReader(loglines.String())), store, fmt.Sprintf("stream-%d", stream), 0)
+		})
+	}
+	wg.Go(func() {
+		for range 100 {
+			for _, v := range *store.Snapshot() {
+				_ = v.Nodepool
+			}
+		}
+	})
+	wg.Wait()
+	if store.Len() != 200 {
+		t.Errorf("expected 200 nodeclaims, got %d", store.Len())
+	}
+}
+
+// internal helper function to load all sample inputs as representative fixture of mixed Karpenter versions and messages
+func loadBenchmarkFixture(b *testing.B) []string {
+	b.Helper()
+	var loglines []string
+	for _, filename := range []string{"../sample-input.txt", "../sample-input-mixed.txt", "../sample-input-combined.txt"} {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			b.Fatalf("failed to read benchmark fixture: %v", err)
+		}
+		loglines = append(loglines, strings.Split(strings.TrimSpace(string(content)), "\n")...)
+	}
+	return loglines
+}
+
+func BenchmarkParseKarpenterLogs(b *testing.B) {
+	loglines := loadBenchmarkFixture(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		// cluster-level state grows with every parsed fixture, so every iteration parses with a new Parser
+		p := NewParserWithOptions(Options{})
+		nodeclaimmap := make(map[string]Nodeclaimstruct)
+		k8snodenamemap := make(map[string]string)
+		for i, logline := range loglines {
+			p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "benchmark", i+1)
+		}
+	}
+	b.ReportMetric(float64(b.N*len(loglines))/b.Elapsed().Seconds(), "lines/s")
+}
+
+// parsing of concurrent pod log streams like in cluster mode, every stream parses into its own maps with one shared Parser
+func BenchmarkParseKarpenterLogsParallel(b *testing.B) {
+	loglines := loadBenchmarkFixture(b)
+	p := NewParserWithOptions(Options{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			nodeclaimmap := make(map[string]Nodeclaimstruct)
+			k8snodenamemap := make(map[string]string)
+			for i, logline := range loglines {
+				p.ParseKarpenterLogs(logline, &nodeclaimmap, &k8snodenamemap, "benchmark", i+1)
+			}
+		}
+	})
+	b.ReportMetric(float64(b.N*len(loglines))/b.Elapsed().Seconds(), "lines/s")
+}
+
+func TestResilientParserDirectives(t *testing.T) {
+	content, err := os.ReadFile("../sample-input-mixed.txt")
+	if err != nil {
+		t.Fatalf("failed to read mixed version sample input: %v", err)
+	}
+	nodeclaimmap := make(map[string]Nodeclaimstruct)
+	k8snodenamemap := make(map[string]string)
+	p := NewParserWithOptions(Options{Formatdirectives: true})
+	p.ResilientParser(strings.NewReader("#lp4k-format: json\n#karpenter-version: v1.1.3\n"+string(content)), &nodeclaimmap, &k8snodenamemap, "sample-input-mixed.txt", 0)
+
+	// only the Karpenter 1.1.x layouts are matched, so the disruption of the 1.0.x nodeclaim is not parsed
+	if got := nodeclaimmap["default-v11cd"].Disruptionreason; got != "empty" {
+		t.Errorf("expected disruption reason \"empty\" of 1.1.x nodeclaim, got %q", got)
+	}
+	if got := nodeclaimmap["default-v10ab"].Disruptionreason; got != "" {
+		t.Errorf("expected no disruption reason of 1.0.x nodeclaim, got %q", got)
+	}
+	if p.hints.version != nil || p.hints.format != "" {
+		t.Errorf("expected hints to be reset after parsing, got %+v", p.hints)
+	}
+}
+
+func TestCloseWarnings(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "warnings")
+	if err != nil {
+		t.Fatalf("failed to create warnings file: %v", err)
+	}
+	defer func(logger *slog.Logger) { warnlogger = logger }(warnlogger)
+	warnfile, warnlogger = file, slog.New(slog.NewJSONHandler(file, nil))
+	logWarning(slog.LevelWarn, "created nodeclaim", "no match", "{}", 1, "test")
+	CloseWarnings()
+	if warnfile != nil {
+		t.Errorf("expected no warnings file after close")
+	}
+	if _, err := file.Write(nil); err == nil {
+		t.Errorf("expected closed warnings file")
+	}
+	content, err := os.ReadFile(file.Name())
+	if err != nil || !strings.Contains(string(content), `"reason":"no match"`) {
+		t.Errorf("expected warning record in warnings file, got %q (%v)", content, err)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// environment variables
+	profileEnv = "LP4K_PROFILE"
+)
+
+// accumulated parsing time of one Karpenter log message
+type profilestruct struct {
+	count int
+	total time.Duration
+}
+
+// parsing time per message of a Parser, guarded by mutex because pod log streams are parsed concurrently
+type parseprofile struct {
+	mutex    sync.Mutex
+	messages map[string]*profilestruct
+}
+
+// internal helper function to determine profiling mode via OS environment
+func init() {
+	envoptions.Profile, _ = strconv.ParseBool(os.Getenv(profileEnv))
+}
+
+// internal helper function to add the time since start to the total of message, only called if LP4K_PROFILE is set
+func (pp *parseprofile) profileMessage(message string, start time.Time) {
+	elapsed := time.Since(start)
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	entry, ok := pp.messages[message]
+	if !ok {
+		entry = &profilestruct{}
+		pp.messages[message] = entry
+	}
+	entry.count++
+	entry.total += elapsed
+}
+
+// PrintProfile prints parsing time of p per Karpenter log message to STDERR ordered by total time if LP4K_PROFILE is set
+func (p *Parser) PrintProfile() {
+	if !p.options.Profile {
+		return
+	}
+	profilemap := p.profiling.messages
+	p.profiling.mutex.Lock()
+	defer p.profiling.mutex.Unlock()
+	messages := make([]string, 0, len(profilemap))
+	for k := range profilemap {
+		messages = append(messages, k)
+	}
+	sort.Slice(messages, func(i, j int) bool { return profilemap[messages[i]].total > profilemap[messages[j]].total })
+	fmt.Fprintf(os.Stderr, "\nParsing time per message:\n")
+	fmt.Fprintf(os.Stderr, "%12s %10s %10s  %s\n", "Total", "Count", "Average", "Message")
+	for _, message := range messages {
+		entry := profilemap[message]
+		fmt.Fprintf(os.Stderr, "%12s %10d %10s  %s\n", entry.total, entry.count, entry.total/time.Duration(entry.count), message)
+	}
+}
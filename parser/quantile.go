@@ -0,0 +1,141 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"math"
+	"slices"
+	"sync"
+)
+
+// Quantiles are the node ready time quantiles estimated while parsing and reported in the summary
+var Quantiles = []float64{0.5, 0.9, 0.99}
+
+// P² streaming quantile estimator (Jain/Chlamtac), keeps five markers per quantile, so every update is O(1)
+type p2quantile struct {
+	q     float64
+	count int
+	n     [5]float64 // marker positions
+	np    [5]float64 // desired marker positions
+	dn    [5]float64 // increments of desired marker positions
+	h     [5]float64 // marker heights
+}
+
+// node ready time estimators of a Parser, updated by parser goroutines and read concurrently by the metrics endpoint
+type readyestimators struct {
+	mutex      sync.Mutex
+	estimators []*p2quantile
+}
+
+// internal helper function to create one estimator per quantile of Quantiles
+func newReadyQuantiles() []*p2quantile {
+	estimators := make([]*p2quantile, len(Quantiles))
+	for i, q := range Quantiles {
+		estimators[i] = &p2quantile{q: q, np: [5]float64{0, 2 * q, 4 * q, 2 + 2*q, 4}, dn: [5]float64{0, q / 2, q, (1 + q) / 2, 1}}
+	}
+	return estimators
+}
+
+// internal helper function to add an observation to the estimator
+func (p *p2quantile) add(x float64) {
+	// the first five observations are kept sorted as initial marker heights
+	if p.count < 5 {
+		p.h[p.count] = x
+		p.count++
+		slices.Sort(p.h[:p.count])
+		if p.count == 5 {
+			p.n = [5]float64{0, 1, 2, 3, 4}
+		}
+		return
+	}
+	p.count++
+	var k int
+	switch {
+	case x < p.h[0]:
+		p.h[0] = x
+	case x >= p.h[4]:
+		p.h[4] = x
+		k = 3
+	default:
+		for k = 0; x >= p.h[k+1]; k++ {
+		}
+	}
+	for i := k + 1; i < 5; i++ {
+		p.n[i]++
+	}
+	for i := range p.np {
+		p.np[i] += p.dn[i]
+	}
+	// adjust heights of the three middle markers if they are off their desired position by one or more
+	for i := 1; i <= 3; i++ {
+		d := p.np[i] - p.n[i]
+		if (d >= 1 && p.n[i+1]-p.n[i] > 1) || (d <= -1 && p.n[i-1]-p.n[i] < -1) {
+			ds := math.Copysign(1, d)
+			h := p.h[i] + ds/(p.n[i+1]-p.n[i-1])*((p.n[i]-p.n[i-1]+ds)*(p.h[i+1]-p.h[i])/(p.n[i+1]-p.n[i])+(p.n[i+1]-p.n[i]-ds)*(p.h[i]-p.h[i-1])/(p.n[i]-p.n[i-1]))
+			if p.h[i-1] >= h || h >= p.h[i+1] {
+				// parabolic prediction out of order, fall back to linear
+				j := i + int(ds)
+				h = p.h[i] + ds*(p.h[j]-p.h[i])/(p.n[j]-p.n[i])
+			}
+			p.h[i] = h
+			p.n[i] += ds
+		}
+	}
+}
+
+// internal helper function to return the current estimate, exact for less than five observations
+func (p *p2quantile) value() float64 {
+	if p.count == 0 {
+		return 0
+	}
+	if p.count < 5 {
+		return exactQuantile(p.h[:p.count], p.q)
+	}
+	return p.h[2]
+}
+
+// internal helper function to return the q quantile of sorted values by nearest rank
+func exactQuantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// internal helper function to add a node ready time to all estimators
+func (r *readyestimators) observeNodeready(sec float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, p := range r.estimators {
+		p.add(sec)
+	}
+}
+
+// NodereadyQuantiles returns the number of node ready times observed by p while parsing and the estimated value of each of Quantiles
+func (p *Parser) NodereadyQuantiles() (int, []float64) {
+	r := &p.readyquantiles
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	values := make([]float64, len(r.estimators))
+	for i, estimator := range r.estimators {
+		values[i] = estimator.value()
+	}
+	return r.estimators[0].count, values
+}
+
+// internal helper function to compute Quantiles of Nodereadytimesec of all initialized nodeclaims exactly, used for the final report
+func nodereadyExactQuantiles(nodeclaimmap *map[string]Nodeclaimstruct) (int, []float64) {
+	var readytimes []float64
+	for _, v := range *nodeclaimmap {
+		if v.Initialized && v.Initializedtime != "" && v.Createdtime != "" {
+			readytimes = append(readytimes, v.Nodereadytimesec)
+		}
+	}
+	slices.Sort(readytimes)
+	values := make([]float64, len(Quantiles))
+	for i, q := range Quantiles {
+		values[i] = exactQuantile(readytimes, q)
+	}
+	return len(readytimes), values
+}
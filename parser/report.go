@@ -0,0 +1,570 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// environment variables
+	groupbyEnv        = "LP4K_GROUP_BY"
+	instancepricesEnv = "LP4K_INSTANCE_PRICES"
+)
+
+// name of Nodeclaimstruct field used to group output, empty means no grouping
+var groupby string
+
+// hourly price per instance type like "m5.large=0.096,i3.large=0.156", used for best-effort cost estimates
+var instanceprices = make(map[string]float64)
+
+// struct for aggregated values of one group
+type groupstruct struct {
+	nodeclaims           int
+	launched             int
+	initialized          int
+	deleted              int
+	nodereadytimesec     float64
+	nodelifecycletimesec float64
+}
+
+// internal helper function to determine report options via OS environment
+func init() {
+	if val := os.Getenv(groupbyEnv); val != "" {
+		if field, ok := reflect.TypeOf(Nodeclaimstruct{}).FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, val) }); ok {
+			groupby = field.Name
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid environment variable %s \"%s\", must be a nodeclaim field name like \"Instancefamily\" or \"Nodepool\" - grouping disabled\n", groupbyEnv, val)
+		}
+	}
+	for val := range strings.SplitSeq(os.Getenv(instancepricesEnv), ",") {
+		if val = strings.TrimSpace(val); val == "" {
+			continue
+		}
+		instancetype, pricestr, _ := strings.Cut(val, "=")
+		if price, err := strconv.ParseFloat(pricestr, 64); err == nil && instancetype != "" {
+			instanceprices[instancetype] = price
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid entry \"%s\" in environment variable %s, must be like \"m5.large=0.096\" - ignoring it\n", val, instancepricesEnv)
+		}
+	}
+}
+
+// PrintGroupedResult prints one CSV line per distinct value of field with counts and average ready and lifecycle times
+func PrintGroupedResult(nodeclaimmap *map[string]Nodeclaimstruct, field string) {
+	if len((*nodeclaimmap)) == 0 {
+		fmt.Fprintf(os.Stderr, "\nNo results - empty \"nodeclaim\" map\n")
+		return
+	}
+	groups := make(map[string]*groupstruct)
+	for _, v := range sortResult(nodeclaimmap) {
+		key := fmt.Sprint(reflect.ValueOf(v.value).FieldByName(field).Interface())
+		group, ok := groups[key]
+		if !ok {
+			group = &groupstruct{}
+			groups[key] = group
+		}
+		group.nodeclaims++
+		if v.value.Launchedtime != "" {
+			group.launched++
+		}
+		if v.value.Initialized {
+			group.initialized++
+			group.nodereadytimesec += v.value.Nodereadytimesec
+		}
+		if v.value.Deleted {
+			group.deleted++
+			group.nodelifecycletimesec += v.value.Nodelifecycletimesec
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Printf("%s,Nodeclaims,Launched,Initialized,Deleted,Avgnodereadytimesec,Avgnodelifecycletimesec\n", field)
+	for _, k := range keys {
+		group := groups[k]
+		fmt.Printf("%s,%d,%d,%d,%d,%.3f,%.3f\n", k, group.nodeclaims, group.launched, group.initialized, group.deleted, average(group.nodereadytimesec, group.initialized), average(group.nodelifecycletimesec, group.deleted))
+	}
+}
+
+// number of nodeclaims which reached each lifecycle stage
+type stagestruct struct {
+	launched           int
+	registered         int
+	initialized        int
+	deleted            int
+	failedregistration int
+	spannedrestart     int
+}
+
+// internal helper function to count nodeclaims per lifecycle stage
+func countStages(nodeclaimmap *map[string]Nodeclaimstruct) stagestruct {
+	var stages stagestruct
+	for _, v := range *nodeclaimmap {
+		if v.Launchedtime != "" {
+			stages.launched++
+		}
+		if v.Registeredtime != "" {
+			stages.registered++
+		}
+		if v.Initialized {
+			stages.initialized++
+		}
+		if v.Deleted {
+			stages.deleted++
+		}
+		if v.Failedregistration {
+			stages.failedregistration++
+		}
+		if v.Spannedrestart {
+			stages.spannedrestart++
+		}
+	}
+	return stages
+}
+
+// PrintCount prints the number of distinct nodeclaims and the number of nodeclaims per lifecycle stage
+func PrintCount(nodeclaimmap *map[string]Nodeclaimstruct) {
+	stages := countStages(nodeclaimmap)
+	fmt.Println(len(*nodeclaimmap))
+	fmt.Printf("launched=%d registered=%d initialized=%d deleted=%d\n", stages.launched, stages.registered, stages.initialized, stages.deleted)
+}
+
+// PrintSummary prints nodeclaim counts and Karpenter controller restarts parsed by p to STDERR
+func (p *Parser) PrintSummary(nodeclaimmap *map[string]Nodeclaimstruct) {
+	stages := countStages(nodeclaimmap)
+	fmt.Fprintf(os.Stderr, "\nSummary: %d nodeclaims, %d launched, %d initialized, %d deleted\n", len(*nodeclaimmap), stages.launched, stages.initialized, stages.deleted)
+	if stages.failedregistration > 0 {
+		fmt.Fprintf(os.Stderr, "Failed registrations: %d nodeclaims terminated due to registration TTL\n", stages.failedregistration)
+	}
+	printReadyQuantileSummary(nodeclaimmap)
+	printDisruptionBlockSummary(p.DisruptionBlocks())
+	printInstancetypeSummary(nodeclaimmap)
+	printConsolidationSummary(nodeclaimmap)
+	printOutcomeSummary(nodeclaimmap)
+	if restarts := p.Restarts(); len(restarts) > 0 {
+		fmt.Fprintf(os.Stderr, "Karpenter controller restarts: %d (%s), %d nodeclaims spanned a restart\n", len(restarts), strings.Join(restarts, ","), stages.spannedrestart)
+	}
+}
+
+// internal helper function to print the distinct launched instance types with their number of nodeclaims to STDERR
+// sorted by count descending and instance type, nodeclaims without Instancetype are not launched and skipped
+func printInstancetypeSummary(nodeclaimmap *map[string]Nodeclaimstruct) {
+	counts := make(map[string]int)
+	for _, v := range *nodeclaimmap {
+		if v.Instancetype != "" {
+			counts[v.Instancetype]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+	instancetypes := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	launched := make([]string, len(instancetypes))
+	for i, instancetype := range instancetypes {
+		launched[i] = fmt.Sprintf("%s=%d", instancetype, counts[instancetype])
+	}
+	fmt.Fprintf(os.Stderr, "Launched instance types: %d (%s)\n", len(instancetypes), strings.Join(launched, ","))
+}
+
+// internal helper function to print the number of blocked disruptions per nodepool and reason to STDERR
+// this answers why Karpenter does not consolidate nodes, which the nodeclaim lifecycle alone cannot explain
+func printDisruptionBlockSummary(blocks []Disruptionblock) {
+	if len(blocks) == 0 {
+		return
+	}
+	counts := make(map[[2]string]int)
+	for _, block := range blocks {
+		counts[[2]string{block.Nodepool, block.Reason}]++
+	}
+	fmt.Fprintf(os.Stderr, "Disruption blocked: %d times, last at %s\n", len(blocks), blocks[len(blocks)-1].Time)
+	fmt.Fprintf(os.Stderr, "Nodepool,Reason,Blocked\n")
+	for _, key := range slices.SortedFunc(maps.Keys(counts), func(a, b [2]string) int {
+		if c := strings.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		return strings.Compare(a[1], b[1])
+	}) {
+		fmt.Fprintf(os.Stderr, "%s,%s,%d\n", key[0], strings.ReplaceAll(key[1], ",", ";"), counts[key])
+	}
+}
+
+// internal helper function to print exact node ready time quantiles of all initialized nodeclaims to STDERR
+func printReadyQuantileSummary(nodeclaimmap *map[string]Nodeclaimstruct) {
+	count, values := nodereadyExactQuantiles(nodeclaimmap)
+	if count == 0 {
+		return
+	}
+	quantiles := make([]string, len(Quantiles))
+	for i, q := range Quantiles {
+		quantiles[i] = fmt.Sprintf("p%.0f=%.1fs", q*100, values[i])
+	}
+	fmt.Fprintf(os.Stderr, "Node ready time: %s (%d initialized nodeclaims)\n", strings.Join(quantiles, " "), count)
+}
+
+// internal helper function to print a cross table of lifecycle outcome by disruption reason to STDERR
+// interrupted nodeclaims are counted as reason "interrupted", nodeclaims never disrupted as "none"
+func printOutcomeSummary(nodeclaimmap *map[string]Nodeclaimstruct) {
+	// counts per reason: not ready, running, deleted
+	outcomes := make(map[string]*[3]int)
+	for _, v := range *nodeclaimmap {
+		reason := v.Disruptionreason
+		if v.Interruptionkind != "" {
+			reason = "interrupted"
+		} else if reason == "" {
+			reason = "none"
+		}
+		if outcomes[reason] == nil {
+			outcomes[reason] = &[3]int{}
+		}
+		switch {
+		case v.Deleted:
+			outcomes[reason][2]++
+		case v.Initialized:
+			outcomes[reason][1]++
+		default:
+			outcomes[reason][0]++
+		}
+	}
+	if len(outcomes) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Lifecycle outcome by disruption reason:\n")
+	fmt.Fprintf(os.Stderr, "Reason,Nodeclaims,Notready,Running,Deleted\n")
+	for _, reason := range slices.Sorted(maps.Keys(outcomes)) {
+		counts := outcomes[reason]
+		fmt.Fprintf(os.Stderr, "%s,%d,%d,%d,%d\n", reason, counts[0]+counts[1]+counts[2], counts[0], counts[1], counts[2])
+	}
+}
+
+// internal helper function to print nodes removed and added by consolidation and the hourly cost of removed nodes to STDERR
+// replacement nodeclaims cannot be correlated with their disruption, so the cost delta covers removed nodes only
+func printConsolidationSummary(nodeclaimmap *map[string]Nodeclaimstruct) {
+	var removed, added, unpriced int
+	var removedcost float64
+	// disrupted nodeclaims of one disruption command share Disruptioncommandid (or Disruptiontime) and Replacementnodecount
+	commands := make(map[string]bool)
+	for _, v := range *nodeclaimmap {
+		if v.Disruptionreason != "underutilized" && v.Disruptionreason != "empty" {
+			continue
+		}
+		removed++
+		command := v.Disruptioncommandid
+		if command == "" {
+			command = v.Disruptiontime
+		}
+		if !commands[command] {
+			commands[command] = true
+			replacements, _ := strconv.Atoi(v.Replacementnodecount)
+			added += replacements
+		}
+		if price, ok := instanceprices[v.Instancetype]; ok {
+			removedcost += price
+		} else {
+			unpriced++
+		}
+	}
+	if removed == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Consolidation: %d disruptions, %d nodes removed, %d nodes added\n", len(commands), removed, added)
+	if unpriced == removed {
+		fmt.Fprintf(os.Stderr, "Consolidation hourly cost delta: unknown, set %s for an estimate\n", instancepricesEnv)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Consolidation hourly cost delta: approx. -%.3f for removed nodes, excluding %d replacement nodes", removedcost, added)
+	if unpriced > 0 {
+		fmt.Fprintf(os.Stderr, " and %d removed nodes without price", unpriced)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// Fielddiff is one changed field of a nodeclaim present in two nodeclaim maps
+type Fielddiff struct {
+	Nodeclaim string `json:"nodeclaim"`
+	Field     string `json:"field"`
+	Old       string `json:"old"`
+	New       string `json:"new"`
+}
+
+// DiffNodeclaims returns all differing fields of nodeclaims present in both maps, sorted by nodeclaim name and field order
+func DiffNodeclaims(oldmap *map[string]Nodeclaimstruct, newmap *map[string]Nodeclaimstruct) []Fielddiff {
+	var diffs []Fielddiff
+	reflecttype := reflect.TypeOf(Nodeclaimstruct{})
+	for _, k := range slices.Sorted(maps.Keys(*oldmap)) {
+		newval, ok := (*newmap)[k]
+		if !ok {
+			continue
+		}
+		oldreflect := reflect.ValueOf((*oldmap)[k])
+		newreflect := reflect.ValueOf(newval)
+		for i := range reflecttype.NumField() {
+			oldfield := fmt.Sprint(formatValue(oldreflect.Field(i)))
+			newfield := fmt.Sprint(formatValue(newreflect.Field(i)))
+			if oldfield != newfield {
+				diffs = append(diffs, Fielddiff{Nodeclaim: k, Field: reflecttype.Field(i).Name, Old: oldfield, New: newfield})
+			}
+		}
+	}
+	return diffs
+}
+
+// PrintDiff prints changed fields as CSV "nodeclaim,field,old,new" or as JSON array if format is "json"
+func PrintDiff(diffs []Fielddiff, format string) {
+	if format == "json" {
+		val, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "JSON encoding error while encoding diff - %s\n", err.Error())
+			return
+		}
+		fmt.Println(string(val))
+		return
+	}
+	fmt.Println("nodeclaim,field,old,new")
+	for _, d := range diffs {
+		fmt.Printf("%s,%s,%s,%s\n", d.Nodeclaim, d.Field, d.Old, d.New)
+	}
+}
+
+// internal helper function to calculate an average without dividing by zero
+func average(sum float64, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// PrintNodeResult prints nodeclaims keyed and sorted by K8s node name using the k8snodename to nodeclaim relationship
+// nodeclaims which never registered a node are omitted and only counted on STDERR
+func PrintNodeResult(nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string) {
+	nodeclaimmap = outputNodeclaims(nodeclaimmap)
+	if len((*k8snodenamemap)) == 0 {
+		fmt.Fprintf(os.Stderr, "\nNo results - empty \"k8snodename\" map\n")
+		return
+	}
+	k8snodenames := make([]string, 0, len(*k8snodenamemap))
+	for k := range *k8snodenamemap {
+		if _, ok := (*nodeclaimmap)[(*k8snodenamemap)[k]]; ok {
+			k8snodenames = append(k8snodenames, k)
+		}
+	}
+	sort.Strings(k8snodenames)
+	fmt.Printf("K8snodename,%s\n", header)
+	for _, k := range k8snodenames {
+		nodeclaim := (*k8snodenamemap)[k]
+		fmt.Printf("%s,%s", k, nodeclaim)
+		reflectval := reflect.ValueOf((*nodeclaimmap)[nodeclaim])
+		for i := range reflectval.NumField() {
+			fmt.Print(",", formatValue(reflectval.Field(i)))
+		}
+		fmt.Println()
+	}
+	if omitted := len(*nodeclaimmap) - len(k8snodenames); omitted > 0 {
+		fmt.Fprintf(os.Stderr, "\nOmitted %d nodeclaims without K8s node name\n", omitted)
+	}
+}
+
+// PrintStuckDisruptions prints nodeclaims which entered disruption but were not deleted within the parsed logs
+// these are suspects for drains blocked by PDBs, do-not-disrupt pods or finalizers
+func PrintStuckDisruptions(nodeclaimmap *map[string]Nodeclaimstruct) {
+	var stuck []keyvalue
+	for _, v := range sortResult(nodeclaimmap) {
+		if v.value.Disruptiontime != "" && !v.value.Deleted {
+			stuck = append(stuck, v)
+		}
+	}
+	if len(stuck) == 0 {
+		fmt.Fprintf(os.Stderr, "\nNo results - no nodeclaims stuck in disruption\n")
+		return
+	}
+	fmt.Println("Nodeclaim,K8snodename,Disruptiontime,Disruptionreason,Disruptiondecision,Disruptedpodcount,Annotationtime,Tainttime,Taint")
+	for _, v := range stuck {
+		fmt.Printf("%s,%s,%s,%s,%s,%s,%s,%s,%s\n", v.key, v.value.K8snodename, v.value.Disruptiontime, v.value.Disruptionreason, v.value.Disruptiondecision, v.value.Disruptedpodcount, v.value.Annotationtime, v.value.Tainttime, v.value.Taint)
+	}
+}
+
+// PrintTop prints the n slowest to become ready and the n longest-lived nodeclaims as two aligned tables
+// only initialized nodeclaims have a node ready time and only deleted nodeclaims a lifecycle time
+func PrintTop(nodeclaimmap *map[string]Nodeclaimstruct, n int) {
+	var ready, lifecycle []keyvalue
+	for k, v := range *nodeclaimmap {
+		if v.Initialized && v.Nodereadytime > 0 {
+			ready = append(ready, keyvalue{k, v})
+		}
+		if v.Deleted && v.Nodelifecycletime > 0 {
+			lifecycle = append(lifecycle, keyvalue{k, v})
+		}
+	}
+	if len(ready) == 0 && len(lifecycle) == 0 {
+		fmt.Fprintf(os.Stderr, "\nNo results - no initialized or deleted nodeclaims\n")
+		return
+	}
+	printTopTable(fmt.Sprintf("Top %d slowest node ready times", n), "Nodereadytime", ready, n, func(v Nodeclaimstruct) time.Duration { return v.Nodereadytime })
+	fmt.Println()
+	printTopTable(fmt.Sprintf("Top %d longest node lifecycles", n), "Nodelifecycletime", lifecycle, n, func(v Nodeclaimstruct) time.Duration { return v.Nodelifecycletime })
+}
+
+// internal helper function to print the n nodeclaims with the largest duration as aligned table, ties are broken by nodeclaim name
+func printTopTable(title string, column string, s []keyvalue, n int, duration func(Nodeclaimstruct) time.Duration) {
+	sort.Slice(s, func(i, j int) bool {
+		if di, dj := duration(s[i].value), duration(s[j].value); di != dj {
+			return di > dj
+		}
+		return s[i].key < s[j].key
+	})
+	fmt.Println(title)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Nodeclaim\tNodepool\tInstancetype\t%s\n", column)
+	for _, v := range s[:min(len(s), n)] {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\n", v.key, v.value.Nodepool, v.value.Instancetype, formatValue(reflect.ValueOf(duration(v.value))))
+	}
+	w.Flush()
+}
+
+// PrintFunnel prints how many created nodeclaims reached each lifecycle stage as CSV with the percentage of the previous stage and of created nodeclaims
+// a low percentage shows where nodeclaims fall out of the lifecycle, like created but never launched for capacity problems
+func PrintFunnel(nodeclaimmap *map[string]Nodeclaimstruct) {
+	stages := countStages(nodeclaimmap)
+	created := len(*nodeclaimmap)
+	fmt.Println("stage,nodeclaims,step_pct,total_pct")
+	previous := created
+	for _, stage := range []struct {
+		name  string
+		count int
+	}{
+		{"created", created},
+		{"launched", stages.launched},
+		{"registered", stages.registered},
+		{"initialized", stages.initialized},
+		{"deleted", stages.deleted},
+	} {
+		fmt.Printf("%s,%d,%.1f,%.1f\n", stage.name, stage.count, percentage(stage.count, previous), percentage(stage.count, created))
+		previous = stage.count
+	}
+}
+
+// internal helper function to return n as percentage of total, 0 if total is 0
+func percentage(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// PrintCapacityRatio prints the number of launched spot and on-demand nodeclaims and the spot percentage per nodepool as CSV
+// with byzone the counts are split per zone as well, otherwise zone is "all", other capacity types are not counted
+func PrintCapacityRatio(nodeclaimmap *map[string]Nodeclaimstruct, byzone bool) {
+	// spot and on-demand counts per nodepool and zone
+	counts := make(map[[2]string]*[2]int)
+	for _, v := range *nodeclaimmap {
+		if v.Capacitytype != "spot" && v.Capacitytype != "on-demand" {
+			continue
+		}
+		key := [2]string{v.Nodepool, "all"}
+		if byzone {
+			key[1] = v.Zone
+		}
+		if counts[key] == nil {
+			counts[key] = &[2]int{}
+		}
+		if v.Capacitytype == "spot" {
+			counts[key][0]++
+		} else {
+			counts[key][1]++
+		}
+	}
+	if len(counts) == 0 {
+		fmt.Fprintf(os.Stderr, "\nNo results - no launched spot or on-demand nodeclaims\n")
+		return
+	}
+	fmt.Println("nodepool,zone,spot,ondemand,spot_pct")
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b [2]string) int {
+		if c := strings.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		return strings.Compare(a[1], b[1])
+	})
+	for _, key := range keys {
+		spot, ondemand := counts[key][0], counts[key][1]
+		fmt.Printf("%s,%s,%d,%d,%.1f\n", key[0], key[1], spot, ondemand, float64(spot)*100/float64(spot+ondemand))
+	}
+}
+
+// ParseHistogramBuckets parses comma separated, ascending bucket upper bounds like "30s,60s,2m"
+func ParseHistogramBuckets(bucketsstr string) ([]time.Duration, error) {
+	var buckets []time.Duration
+	for val := range strings.SplitSeq(bucketsstr, ",") {
+		bucket, err := time.ParseDuration(strings.TrimSpace(val))
+		if err != nil {
+			return nil, err
+		}
+		if bucket <= 0 || (len(buckets) > 0 && bucket <= buckets[len(buckets)-1]) {
+			return nil, errors.New("bucket upper bounds must be positive and ascending")
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// internal helper function to count initialized nodeclaims per node ready time bucket, returns bucket labels and counts
+// the last bucket collects all node ready times above the highest upper bound
+func histogramCounts(nodeclaimmap *map[string]Nodeclaimstruct, buckets []time.Duration) ([]string, []int) {
+	counts := make([]int, len(buckets)+1)
+	for _, v := range *nodeclaimmap {
+		if !v.Initialized {
+			continue
+		}
+		idx := sort.Search(len(buckets), func(i int) bool { return v.Nodereadytimesec < buckets[i].Seconds() })
+		counts[idx]++
+	}
+	labels := make([]string, len(counts))
+	var lower time.Duration
+	for i, bucket := range buckets {
+		labels[i] = fmt.Sprintf("%s-%s", lower, bucket)
+		lower = bucket
+	}
+	labels[len(buckets)] = fmt.Sprintf(">%s", lower)
+	return labels, counts
+}
+
+// PrintHistogram prints the number of initialized nodeclaims per Nodereadytimesec bucket as CSV or as text bar chart
+// the last bucket collects all node ready times above the highest upper bound
+func PrintHistogram(nodeclaimmap *map[string]Nodeclaimstruct, buckets []time.Duration, chart bool) {
+	if len((*nodeclaimmap)) == 0 {
+		fmt.Fprintf(os.Stderr, "\nNo results - empty \"nodeclaim\" map\n")
+		return
+	}
+	labels, counts := histogramCounts(nodeclaimmap, buckets)
+	if !chart {
+		fmt.Println("Nodereadytime,Nodeclaims")
+		for i, count := range counts {
+			fmt.Printf("%s,%d\n", labels[i], count)
+		}
+		return
+	}
+	width := 0
+	for _, label := range labels {
+		width = max(width, len(label))
+	}
+	for i, count := range counts {
+		fmt.Printf("%-*s | %s %d\n", width, labels[i], strings.Repeat("#", count), count)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// environment variables
+	sinksEnv      = "LP4K_SINKS"
+	outputfileEnv = "LP4K_OUTPUT_FILE"
+	outputgzipEnv = "LP4K_OUTPUT_GZIP"
+)
+
+// Sink is an output target which renders all nodeclaims on every update and at shutdown
+type Sink interface {
+	Name() string
+	Write(nodeclaimmap *map[string]Nodeclaimstruct) error
+}
+
+// configured sink names like "stdout,configmap", nil means mode specific defaults
+var sinknames map[string]bool
+var outputfile string
+
+// gzip compress output of file and S3 sinks, ".gz" is appended to their names
+var outputgzip bool
+
+// internal helper function to determine sinks via OS environment
+func init() {
+	if val := os.Getenv(sinksEnv); val != "" {
+		sinknames = make(map[string]bool)
+		for name := range strings.SplitSeq(val, ",") {
+			switch name = strings.ToLower(strings.TrimSpace(name)); name {
+			case "stdout", "file", "configmap", "s3", "remotewrite":
+				sinknames[name] = true
+			default:
+				fmt.Fprintf(os.Stderr, "Warning: Invalid sink \"%s\" in environment variable %s, must be \"stdout\", \"file\", \"configmap\", \"s3\" or \"remotewrite\" - ignoring it\n", name, sinksEnv)
+			}
+		}
+	}
+	outputfile = os.Getenv(outputfileEnv)
+	outputgzip, _ = strconv.ParseBool(os.Getenv(outputgzipEnv))
+}
+
+// CompressOutput gzip compresses rendered output if LP4K_OUTPUT_GZIP=true and returns it with the name suffix ".gz"
+// otherwise output is returned unchanged with an empty suffix
+func CompressOutput(output []byte) ([]byte, string, error) {
+	if !outputgzip {
+		return output, "", nil
+	}
+	var buffer bytes.Buffer
+	gzipwriter := gzip.NewWriter(&buffer)
+	if _, err := gzipwriter.Write(output); err != nil {
+		return nil, "", err
+	}
+	if err := gzipwriter.Close(); err != nil {
+		return nil, "", err
+	}
+	return buffer.Bytes(), ".gz", nil
+}
+
+// SinkEnabled returns whether the named sink is listed in LP4K_SINKS or defaultVal if LP4K_SINKS is not set
+func SinkEnabled(name string, defaultVal bool) bool {
+	if sinknames == nil {
+		return defaultVal
+	}
+	return sinknames[name]
+}
+
+// StdoutSink prints sorted nodeclaims to STDOUT
+type StdoutSink struct{}
+
+func (StdoutSink) Name() string {
+	return "stdout"
+}
+
+func (StdoutSink) Write(nodeclaimmap *map[string]Nodeclaimstruct) error {
+	PrintSortedResult(nodeclaimmap)
+	return nil
+}
+
+// FileSink writes sorted nodeclaims in LP4K_OUTPUT_FORMAT to the file of LP4K_OUTPUT_FILE, the file is replaced on every write
+// with LP4K_OUTPUT_GZIP=true the output is gzip compressed into the file with ".gz" appended
+type FileSink struct {
+	Path string
+}
+
+func (f FileSink) Name() string {
+	return "file"
+}
+
+func (f FileSink) Write(nodeclaimmap *map[string]Nodeclaimstruct) error {
+	output, suffix, err := CompressOutput([]byte(ConvertOutput(nodeclaimmap)))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.Path+suffix, output, 0644)
+}
+
+// NewFileSink returns a FileSink for LP4K_OUTPUT_FILE or nil if the file sink is disabled
+// the file sink is enabled by default if LP4K_OUTPUT_FILE is set
+func NewFileSink() Sink {
+	if !SinkEnabled("file", outputfile != "") {
+		return nil
+	}
+	if outputfile == "" {
+		fmt.Fprintf(os.Stderr, "Warning: file sink requires environment variable %s - file sink disabled\n", outputfileEnv)
+		return nil
+	}
+	return FileSink{Path: outputfile}
+}
+
+// WriteSinks renders nodeclaims to all sinks, a failing sink does not prevent the others
+// nodeclaims of LP4K_EXCLUDE_NODEPOOL and nodeclaims not existing at LP4K_ACTIVE_AT are not written to any sink
+func WriteSinks(sinks []Sink, nodeclaimmap *map[string]Nodeclaimstruct) {
+	nodeclaimmap = outputNodeclaims(nodeclaimmap)
+	for _, sink := range sinks {
+		if err := sink.Write(nodeclaimmap); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to write %s sink: %v\n", sink.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"bufio"
+	"maps"
+	"sync"
+)
+
+// Nodeclaimstore guards nodeclaimmap and k8snodenamemap, which are written by concurrent parsers like one per Karpenter pod log stream
+// and the Event informer while sinks read them periodically
+type Nodeclaimstore struct {
+	mutex          sync.RWMutex
+	nodeclaimmap   *map[string]Nodeclaimstruct
+	k8snodenamemap *map[string]string
+}
+
+// NewNodeclaimstore returns a store guarding nodeclaimmap and k8snodenamemap, both must not be accessed directly afterwards until all writers finished
+func NewNodeclaimstore(nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string) *Nodeclaimstore {
+	return &Nodeclaimstore{nodeclaimmap: nodeclaimmap, k8snodenamemap: k8snodenamemap}
+}
+
+// Update calls update with exclusive access to nodeclaimmap and k8snodenamemap
+func (s *Nodeclaimstore) Update(update func(nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	update(s.nodeclaimmap, s.k8snodenamemap)
+}
+
+// Snapshot returns a copy of nodeclaimmap, which can be enriched, filtered and written to sinks while parsing continues
+func (s *Nodeclaimstore) Snapshot() *map[string]Nodeclaimstruct {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	snapshot := maps.Clone(*s.nodeclaimmap)
+	return &snapshot
+}
+
+// Len returns the number of nodeclaims in the store
+func (s *Nodeclaimstore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(*s.nodeclaimmap)
+}
+
+// wrapper around main parsing logic without blocking for parsers sharing store, every logline is parsed with exclusive access to store
+func (p *Parser) SynchronizedParser(scanner *bufio.Scanner, store *Nodeclaimstore, stdin string, inputline int) {
+	for scanner.Scan() {
+		inputline++
+		store.Update(func(nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string) {
+			p.ParseKarpenterLogs(scanner.Text(), nodeclaimmap, k8snodenamemap, stdin, inputline)
+		})
+	}
+	scannerErr(scanner, stdin)
+}
@@ -6,25 +6,244 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path"
 	"reflect"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 )
 
+const (
+	// environment variables
+	sortbyEnv          = "LP4K_SORT_BY"
+	sortorderEnv       = "LP4K_SORT_ORDER"
+	durationformatEnv  = "LP4K_DURATION_FORMAT"
+	outputformatEnv    = "LP4K_OUTPUT_FORMAT"
+	templateEnv        = "LP4K_TEMPLATE"
+	keyfieldEnv        = "LP4K_KEY_FIELD"
+	cmcompactEnv       = "LP4K_CM_COMPACT"
+	cmfieldsEnv        = "LP4K_CM_FIELDS"
+	minlifecycleEnv    = "LP4K_MIN_LIFECYCLE"
+	displaytzEnv       = "LP4K_DISPLAY_TZ"
+	excludenodepoolEnv = "LP4K_EXCLUDE_NODEPOOL"
+	activeatEnv        = "LP4K_ACTIVE_AT"
+	// layout of rendered timestamps in LP4K_DISPLAY_TZ, keeps the millisecond precision of Karpenter logs
+	displayLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+var configmapKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// escaping of InfluxDB line protocol tag values and string field values
+var influxTagEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `)
+var influxFieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// output format of nodeclaims on STDOUT and in file sink
+var outputformat string
+
+// template executed per nodeclaim instead of fixed output formats if LP4K_TEMPLATE is set
+var outputtemplate *template.Template
+
+// data of output template, all Nodeclaimstruct fields are available like {{.Createdtime}}
+type templatedata struct {
+	Nodeclaim string
+	Nodeclaimstruct
+}
+
+// name of Nodeclaimstruct field used to sort output (empty means nodeclaim name), sort direction and maximum number of printed nodeclaims (0 means unlimited)
+var sortby = "Createdtime"
+var sortdesc bool
+var limit int
+
+// number of most recently created nodeclaims kept in output regardless of sort field, 0 means all
+var latest int
+
+// name of Nodeclaimstruct field used as output key instead of nodeclaim name (empty) and its column name
+var keyfield string
+var keyname = "Nodeclaim"
+
+// deleted nodeclaims with a shorter lifecycle are excluded from output, 0 means disabled
+var minlifecycle time.Duration
+
+// omit zero-value fields from ConfigMap data to fit more nodeclaims into one ConfigMap
+var cmcompact bool
+
+// Nodeclaimstruct fields serialized into ConfigMap data, nil means all fields
+var cmfields map[string]bool
+
+// rendering of time.Duration fields, empty means Go default like "2m30.123s"
+var durationformat string
+
+// nodepool names or glob patterns like "system-*" whose nodeclaims are excluded from output and reports
+var excludenodepools []string
+
+// only nodeclaims existing at this instant are kept in output and reports, zero means disabled
+var activeat time.Time
+
+// time zone of rendered timestamp fields, nil means UTC as logged by Karpenter
+var displaytz *time.Location
+
 // struct for further sorting of map
 type keyvalue struct {
 	key   string
 	value Nodeclaimstruct
 }
 
+// Header returns the CSV header starting with "Nodeclaim" or LP4K_KEY_FIELD followed by columns, nil columns means all Nodeclaimstruct fields
+// withIndices appends the 1-based CSV column number to every column like "Nodeclaim[1],Createdtime[2]"
+func Header(withIndices bool, columns []string) string {
+	if columns == nil {
+		reflecttype := reflect.TypeOf(Nodeclaimstruct{})
+		for i := range reflecttype.NumField() {
+			columns = append(columns, reflecttype.Field(i).Name)
+		}
+	}
+	names := append([]string{keyname}, columns...)
+	if withIndices {
+		for i := range names {
+			names[i] = fmt.Sprintf("%s[%d]", names[i], i+1)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
 // internal helper function to set header based on Nodeclaimstruct
 func init() {
 	var nodeclaimstruct Nodeclaimstruct
 	reflecttype := reflect.TypeOf(nodeclaimstruct)
-	header = "Nodeclaim[1]"
-	for i := range reflecttype.NumField() {
-		header = fmt.Sprintf("%s,%s[%d]", header, reflecttype.Field(i).Name, i+2)
+	// determine key field of output via OS environment, parsing always correlates by nodeclaim name
+	if val := os.Getenv(keyfieldEnv); val != "" && !strings.EqualFold(val, "nodeclaim") {
+		if field, ok := reflecttype.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, val) }); ok {
+			keyfield = field.Name
+			keyname = field.Name
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid environment variable %s \"%s\", must be a nodeclaim field name like \"Providerid\" or \"K8snodename\" - using nodeclaim name\n", keyfieldEnv, val)
+		}
+	}
+	header = Header(true, nil)
+	// determine sort field and order via OS environment
+	if val := os.Getenv(sortbyEnv); strings.EqualFold(val, "name") || strings.EqualFold(val, "nodeclaim") {
+		// sort by nodeclaim name i.e. map key
+		sortby = ""
+	} else if strings.EqualFold(val, "state") {
+		// sort by lifecycle stage derived from several fields, then by Createdtime
+		sortby = "state"
+	} else if val != "" {
+		if field, ok := reflecttype.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, val) }); ok {
+			sortby = field.Name
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: Invalid environment variable %s \"%s\", must be a nodeclaim field name like \"Nodereadytimesec\" - sorting by \"%s\"\n", sortbyEnv, val, sortby)
+		}
+	}
+	sortdesc = strings.EqualFold(os.Getenv(sortorderEnv), "desc")
+	cmcompact, _ = strconv.ParseBool(os.Getenv(cmcompactEnv))
+	// comma separated Nodeclaimstruct field names like "Createdtime,Nodepool,Nodereadytimesec"
+	if val := os.Getenv(cmfieldsEnv); val != "" {
+		cmfields = make(map[string]bool)
+		for name := range strings.SplitSeq(val, ",") {
+			name = strings.TrimSpace(name)
+			field, ok := reflecttype.FieldByNameFunc(func(fieldname string) bool { return strings.EqualFold(fieldname, name) })
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Invalid environment variable %s, \"%s\" is no nodeclaim field name like \"Createdtime\" or \"Nodereadytimesec\"\n", cmfieldsEnv, name)
+				os.Exit(1)
+			}
+			cmfields[field.Name] = true
+		}
+	}
+	if val := os.Getenv(minlifecycleEnv); val != "" {
+		var err error
+		if minlifecycle, err = time.ParseDuration(val); err != nil || minlifecycle < 0 {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s, must be a non-negative time.Duration format like \"60s\" or \"5m\"\n", minlifecycleEnv)
+			os.Exit(1)
+		}
 	}
+	// comma separated list of nodepool names or glob patterns like "system,critical-*"
+	for pattern := range strings.SplitSeq(os.Getenv(excludenodepoolEnv), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s, \"%s\" is no valid nodepool name or glob pattern\n", excludenodepoolEnv, pattern)
+			os.Exit(1)
+		}
+		excludenodepools = append(excludenodepools, pattern)
+	}
+	// RFC3339 instant like "2025-04-23T14:30:00Z"
+	if val := os.Getenv(activeatEnv); val != "" {
+		var err error
+		if activeat, err = time.Parse(time.RFC3339Nano, val); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s \"%s\", must be a RFC3339 timestamp like \"2025-04-23T14:30:00Z\"\n", activeatEnv, val)
+			os.Exit(1)
+		}
+	}
+	// IANA time zone name like "America/New_York"
+	if val := os.Getenv(displaytzEnv); val != "" {
+		var err error
+		if displaytz, err = time.LoadLocation(val); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s \"%s\", must be a time zone name like \"America/New_York\" - %s\n", displaytzEnv, val, err.Error())
+			os.Exit(1)
+		}
+	}
+	// determine output format via OS environment
+	switch outputformat = strings.ToLower(os.Getenv(outputformatEnv)); outputformat {
+	case "csv", "json", "parquet", "influx", "timeline":
+	case "":
+		outputformat = "csv"
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: Invalid environment variable %s \"%s\", must be \"csv\", \"json\", \"parquet\", \"influx\" or \"timeline\" - using \"csv\"\n", outputformatEnv, outputformat)
+		outputformat = "csv"
+	}
+	// LP4K_TEMPLATE is a Go text/template string or the name of a file containing one
+	if val := os.Getenv(templateEnv); val != "" {
+		if content, err := os.ReadFile(val); err == nil {
+			val = string(content)
+		}
+		var err error
+		if outputtemplate, err = template.New("lp4k").Parse(val); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s - %s\n", templateEnv, err.Error())
+			os.Exit(1)
+		}
+		// catch unknown fields upfront by executing the template on an empty nodeclaim
+		if err := outputtemplate.Execute(io.Discard, templatedata{}); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s - %s\n", templateEnv, err.Error())
+			os.Exit(1)
+		}
+		outputformat = "template"
+	}
+	// determine rendering of durations via OS environment
+	switch durationformat = strings.ToLower(os.Getenv(durationformatEnv)); durationformat {
+	case "", "seconds", "short", "hms":
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: Invalid environment variable %s \"%s\", must be \"seconds\", \"short\" or \"hms\" - using default format\n", durationformatEnv, durationformat)
+		durationformat = ""
+	}
+}
+
+// internal helper function to check if file is a terminal instead of a redirected file or pipe
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// OutputFormat returns the output format of LP4K_OUTPUT_FORMAT like "csv" or "parquet", "template" if LP4K_TEMPLATE is set
+func OutputFormat() string {
+	return outputformat
+}
+
+// SetLimit sets the maximum number of nodeclaims printed after sorting, 0 means unlimited
+func SetLimit(n int) {
+	limit = n
+}
+
+// SetLatest sets the number of most recently created nodeclaims kept in output before sorting and limit, 0 means all
+func SetLatest(n int) {
+	latest = n
 }
 
 // internal helper function to populate nodeclaimmap from K8s ConfigMap data i.e. map[string]string
@@ -38,35 +257,263 @@ func Populatenodeclaimmap(nodeclaimmap *map[string]Nodeclaimstruct, cmdata map[s
 	}
 }
 
-// helper function sorted slice - sort the nodeclaimmap map by createdtime if not empty
+// Populatek8snodenamemap derives the K8s node name to nodeclaim map from the K8snodename fields of nodeclaimmap, for example after reading a ConfigMap
+// if a K8s node name was reused, the most recently created nodeclaim wins like during parsing
+func Populatek8snodenamemap(nodeclaimmap *map[string]Nodeclaimstruct, k8snodenamemap *map[string]string) {
+	for key, val := range *nodeclaimmap {
+		if val.K8snodename == "" {
+			continue
+		}
+		if existing, ok := (*k8snodenamemap)[val.K8snodename]; ok && (*nodeclaimmap)[existing].Createdtime > val.Createdtime {
+			continue
+		}
+		(*k8snodenamemap)[val.K8snodename] = key
+	}
+}
+
+// helper function sorted slice - sort the nodeclaimmap map by createdtime (or LP4K_SORT_BY field) if not empty
+// ties are broken by nodeclaim name, so output is deterministic across runs
 func sortResult(nodeclaimmap *map[string]Nodeclaimstruct) []keyvalue {
 	s := make([]keyvalue, 0, len((*nodeclaimmap)))
 	for k, v := range *nodeclaimmap {
 		s = append(s, keyvalue{k, v})
 	}
-	sort.SliceStable(s, func(i, j int) bool {
-		return s[i].value.Createdtime < s[j].value.Createdtime
+	sortKeyvalues(s)
+	return s
+}
+
+// internal helper function to sort by LP4K_SORT_BY field and order, ties and sorting by name use the key
+func sortKeyvalues(s []keyvalue) {
+	sort.Slice(s, func(i, j int) bool {
+		a, b := s[i], s[j]
+		if sortdesc {
+			a, b = b, a
+		}
+		if sortby == "state" {
+			if ranka, rankb := stateRank(a.value), stateRank(b.value); ranka != rankb {
+				return ranka < rankb
+			}
+			if a.value.Createdtime != b.value.Createdtime {
+				return a.value.Createdtime < b.value.Createdtime
+			}
+		} else if sortby != "" {
+			if lessField(a.value, b.value, sortby) {
+				return true
+			}
+			if lessField(b.value, a.value, sortby) {
+				return false
+			}
+		}
+		return a.key < b.key
 	})
+}
+
+// internal helper function to rank the lifecycle stage of a nodeclaim for LP4K_SORT_BY=state
+// in-progress (not yet initialized) first, then ready, disrupted or interrupted and deleted last
+func stateRank(v Nodeclaimstruct) int {
+	switch {
+	case v.Deleted:
+		return 3
+	case v.Disruptiontime != "" || v.Interruptionkind != "":
+		return 2
+	case v.Initialized:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// internal helper function to replace nodeclaim names by values of LP4K_KEY_FIELD, nodeclaims without value are skipped
+func rekeyResult(s []keyvalue) []keyvalue {
+	rekeyed := make([]keyvalue, 0, len(s))
+	for _, v := range s {
+		if key := fmt.Sprint(reflect.ValueOf(v.value).FieldByName(keyfield).Interface()); key != "" {
+			rekeyed = append(rekeyed, keyvalue{key, v.value})
+		}
+	}
+	if skipped := len(s) - len(rekeyed); skipped > 0 {
+		fmt.Fprintf(os.Stderr, "\nSkipped %d nodeclaims without %s\n", skipped, keyfield)
+	}
+	sortKeyvalues(rekeyed)
+	return rekeyed
+}
+
+// internal helper function to keep the latest most recently created nodeclaims of s in LP4K_SORT_BY order
+func latestResult(s []keyvalue) []keyvalue {
+	recent := slices.Clone(s)
+	sort.Slice(recent, func(i, j int) bool {
+		if recent[i].value.Createdtime != recent[j].value.Createdtime {
+			return recent[i].value.Createdtime > recent[j].value.Createdtime
+		}
+		return recent[i].key < recent[j].key
+	})
+	recent = recent[:latest]
+	sortKeyvalues(recent)
+	return recent
+}
+
+func sortLimitResult(nodeclaimmap *map[string]Nodeclaimstruct) []keyvalue {
+	s := slices.DeleteFunc(sortResult(nodeclaimmap), func(v keyvalue) bool { return shortLifecycle(v.value) })
+	if latest > 0 && latest < len(s) {
+		s = latestResult(s)
+	}
+	if keyfield != "" {
+		s = rekeyResult(s)
+	}
+	if limit > 0 && limit < len(s) {
+		s = s[:limit]
+	}
 	return s
 }
 
+// internal helper function to compare a Nodeclaimstruct field of two nodeclaims based on the field kind
+func lessField(a, b Nodeclaimstruct, field string) bool {
+	va := reflect.ValueOf(a).FieldByName(field)
+	vb := reflect.ValueOf(b).FieldByName(field)
+	switch va.Kind() {
+	case reflect.String:
+		return va.String() < vb.String()
+	case reflect.Int, reflect.Int64:
+		return va.Int() < vb.Int()
+	case reflect.Float64:
+		return va.Float() < vb.Float()
+	case reflect.Bool:
+		return !va.Bool() && vb.Bool()
+	}
+	return false
+}
+
 func PrintSortedResult(nodeclaimmap *map[string]Nodeclaimstruct) {
+	nodeclaimmap = outputNodeclaims(nodeclaimmap)
 	if len((*nodeclaimmap)) == 0 {
 		fmt.Fprintf(os.Stderr, "\nNo results - empty \"nodeclaim\" map\n")
 		return
 	}
-	s := sortResult(nodeclaimmap)
-	fmt.Println(header)
+	// print aggregated groups instead of single nodeclaims if LP4K_GROUP_BY is set
+	if groupby != "" {
+		PrintGroupedResult(nodeclaimmap, groupby)
+		return
+	}
+	if outputformat == "parquet" && isTerminal(os.Stdout) {
+		fmt.Fprintf(os.Stderr, "\nNot printing binary Parquet output to terminal - redirect STDOUT to a file or use %s\n", outputfileEnv)
+		return
+	}
+	if outputformat != "csv" {
+		fmt.Print(ConvertOutput(nodeclaimmap))
+		return
+	}
+	s := sortLimitResult(nodeclaimmap)
+	fmt.Println(Header(true, nil))
 	reflectval := reflect.ValueOf(Nodeclaimstruct{})
 	for _, v := range s {
 		fmt.Print(v.key)
 		for i := range reflectval.NumField() {
-			fmt.Print(",", reflect.ValueOf(v.value).Field(i).Interface())
+			fmt.Print(",", formatValue(reflect.ValueOf(v.value).Field(i)))
 		}
 		fmt.Println()
 	}
 }
 
+// internal helper function to render a Nodeclaimstruct field value, time.Duration fields are rendered according to LP4K_DURATION_FORMAT
+// and timestamp fields in LP4K_DISPLAY_TZ, all calculations use the parsed UTC timestamps
+func formatValue(val reflect.Value) any {
+	if displaytz != nil && val.Kind() == reflect.String {
+		if t, err := time.Parse(time.RFC3339Nano, val.String()); err == nil {
+			return t.In(displaytz).Format(displayLayout)
+		}
+	}
+	if d, ok := val.Interface().(time.Duration); ok {
+		switch durationformat {
+		case "seconds":
+			return fmt.Sprintf("%.2f", d.Seconds())
+		case "short":
+			return d.Round(time.Second).String()
+		case "hms":
+			d = d.Round(time.Second)
+			return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+		}
+	}
+	return val.Interface()
+}
+
+// internal helper function to check if a deleted nodeclaim lived shorter than LP4K_MIN_LIFECYCLE, in-progress nodeclaims are always kept
+func shortLifecycle(v Nodeclaimstruct) bool {
+	return minlifecycle > 0 && v.Deleted && v.Nodelifecycletime < minlifecycle
+}
+
+// internal helper function to check if nodepool matches a name or glob pattern of LP4K_EXCLUDE_NODEPOOL
+func excludedNodepool(nodepool string) bool {
+	for _, pattern := range excludenodepools {
+		if matched, _ := path.Match(pattern, nodepool); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// internal helper function to check if a nodeclaim did not exist at LP4K_ACTIVE_AT, i.e. [Createdtime, Deletedtime] does not contain it
+// nodeclaims without Deletedtime are still active, nodeclaims without Createdtime are never active
+func inactiveAt(v Nodeclaimstruct) bool {
+	if activeat.IsZero() {
+		return false
+	}
+	created, err := time.Parse(time.RFC3339Nano, v.Createdtime)
+	if err != nil || created.After(activeat) {
+		return true
+	}
+	deleted, err := time.Parse(time.RFC3339Nano, v.Deletedtime)
+	return err == nil && deleted.Before(activeat)
+}
+
+// internal helper function to check if a nodeclaim is removed from every output path like nodeclaims of LP4K_EXCLUDE_NODEPOOL
+// and nodeclaims not existing at LP4K_ACTIVE_AT, LP4K_ONLY_NODEPOOL applies at parse time already, so exclude takes precedence if both match
+func excludedOutput(v Nodeclaimstruct) bool {
+	return excludedNodepool(v.Nodepool) || inactiveAt(v)
+}
+
+// internal helper function to return nodeclaimmap without the nodeclaims excluded from output, a copy if any nodeclaim is removed
+// used by WriteSinks and the STDOUT printers, so output filters apply in stream mode and to lp4kcm like after parsing files
+func outputNodeclaims(nodeclaimmap *map[string]Nodeclaimstruct) *map[string]Nodeclaimstruct {
+	if len(excludenodepools) == 0 && activeat.IsZero() {
+		return nodeclaimmap
+	}
+	output := maps.Clone(*nodeclaimmap)
+	maps.DeleteFunc(output, func(_ string, v Nodeclaimstruct) bool { return excludedOutput(v) })
+	return &output
+}
+
+// FilterNodeclaims removes all nodeclaims not matching providerid and k8snode, empty values match all nodeclaims
+// providerid matches the full provider ID like "aws:///eu-west-1a/i-0abc" or just the EC2 instance ID "i-0abc"
+// deleted nodeclaims shorter than LP4K_MIN_LIFECYCLE, nodeclaims of LP4K_EXCLUDE_NODEPOOL and nodeclaims not existing at LP4K_ACTIVE_AT are removed as well
+func FilterNodeclaims(nodeclaimmap *map[string]Nodeclaimstruct, providerid string, k8snode string) {
+	for k, v := range *nodeclaimmap {
+		if shortLifecycle(v) || excludedOutput(v) {
+			delete(*nodeclaimmap, k)
+		} else if providerid != "" && v.Providerid != providerid && !strings.HasSuffix(v.Providerid, "/"+providerid) {
+			delete(*nodeclaimmap, k)
+		} else if k8snode != "" && v.K8snodename != k8snode {
+			delete(*nodeclaimmap, k)
+		}
+	}
+}
+
+// ConvertOutput converts nodeclaimmap to a string in the format of LP4K_OUTPUT_FORMAT
+func ConvertOutput(nodeclaimmap *map[string]Nodeclaimstruct) string {
+	switch outputformat {
+	case "json":
+		return ConvertToJSON(nodeclaimmap)
+	case "parquet":
+		return ConvertToParquet(nodeclaimmap)
+	case "influx":
+		return ConvertToInflux(nodeclaimmap)
+	case "timeline":
+		return ConvertToTimeline(nodeclaimmap)
+	case "template":
+		return ConvertToTemplate(nodeclaimmap)
+	}
+	return ConvertToCSV(nodeclaimmap)
+}
+
 // ConvertToCSV converts nodeclaimmap to a CSV string with header
 func ConvertToCSV(nodeclaimmap *map[string]Nodeclaimstruct) string {
 	var csvBuffer bytes.Buffer
@@ -80,14 +527,14 @@ func ConvertToCSV(nodeclaimmap *map[string]Nodeclaimstruct) string {
 	}
 
 	// Sort and write data
-	s := sortResult(nodeclaimmap)
+	s := sortLimitResult(nodeclaimmap)
 
 	for _, v := range s {
 		csvBuffer.WriteString(v.key)
 
 		reflectval := reflect.ValueOf(v.value)
 		for i := range reflectval.NumField() {
-			csvBuffer.WriteString(fmt.Sprintf(",%v", reflectval.Field(i).Interface()))
+			csvBuffer.WriteString(fmt.Sprintf(",%v", formatValue(reflectval.Field(i))))
 		}
 		csvBuffer.WriteString("\n")
 	}
@@ -95,20 +542,219 @@ func ConvertToCSV(nodeclaimmap *map[string]Nodeclaimstruct) string {
 	return csvBuffer.String()
 }
 
-// ConvertResult is used by k8s package to create ConfigMap data
-func ConvertResult(nodeclaimmap *map[string]Nodeclaimstruct) map[string]string {
+// ConvertToJSON converts nodeclaimmap to a JSON array string of nodeclaim objects
+// object keys are emitted in CSV header order starting with "Nodeclaim" or LP4K_KEY_FIELD, so CSV and JSON columns line up
+func ConvertToJSON(nodeclaimmap *map[string]Nodeclaimstruct) string {
+	var jsonBuffer bytes.Buffer
+
+	jsonBuffer.WriteString("[")
+	for i, v := range sortLimitResult(nodeclaimmap) {
+		if i > 0 {
+			jsonBuffer.WriteString(",")
+		}
+		jsonBuffer.WriteString("\n")
+		jsonBuffer.Write(marshalOrdered(v))
+	}
+	jsonBuffer.WriteString("\n]\n")
+
+	return jsonBuffer.String()
+}
+
+// internal helper function to marshal one nodeclaim as JSON object with keys in Nodeclaimstruct field order
+func marshalOrdered(v keyvalue) []byte {
+	var objBuffer bytes.Buffer
+
+	key, _ := json.Marshal(v.key)
+	fmt.Fprintf(&objBuffer, `{"%s":`, keyname)
+	objBuffer.Write(key)
+	reflectval := reflect.ValueOf(v.value)
+	reflecttype := reflectval.Type()
+	for i := range reflectval.NumField() {
+		val, err := json.Marshal(formatValue(reflectval.Field(i)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "JSON encoding error while encoding field \"%s\" of nodeclaim \"%s\"\n", reflecttype.Field(i).Name, v.key)
+			val = []byte("null")
+		}
+		fmt.Fprintf(&objBuffer, `,"%s":%s`, reflecttype.Field(i).Name, val)
+	}
+	objBuffer.WriteString("}")
+
+	return objBuffer.Bytes()
+}
+
+// ConvertToInflux converts nodeclaimmap to InfluxDB line protocol with one "karpenter_nodeclaim" point per nodeclaim
+// the point timestamp is Createdtime in nanoseconds, empty tags are omitted
+func ConvertToInflux(nodeclaimmap *map[string]Nodeclaimstruct) string {
+	var influxBuffer bytes.Buffer
+	for _, v := range sortLimitResult(nodeclaimmap) {
+		influxBuffer.WriteString("karpenter_nodeclaim")
+		for _, tag := range [][2]string{{"nodepool", v.value.Nodepool}, {"instancetype", v.value.Instancetype}, {"zone", v.value.Zone}, {"capacitytype", v.value.Capacitytype}} {
+			if tag[1] != "" {
+				influxBuffer.WriteString(fmt.Sprintf(",%s=%s", tag[0], influxTagEscaper.Replace(tag[1])))
+			}
+		}
+		influxBuffer.WriteString(fmt.Sprintf(" nodeclaim=\"%s\",nodereadytimesec=%s,bootreadytimesec=%s,nodelifecycletimesec=%s", influxFieldEscaper.Replace(v.key), strconv.FormatFloat(v.value.Nodereadytimesec, 'f', -1, 64), strconv.FormatFloat(v.value.Bootreadytimesec, 'f', -1, 64), strconv.FormatFloat(v.value.Nodelifecycletimesec, 'f', -1, 64)))
+		if createdtime, err := time.Parse(time.RFC3339Nano, v.value.Createdtime); err == nil {
+			influxBuffer.WriteString(fmt.Sprintf(" %d", createdtime.UnixNano()))
+		}
+		influxBuffer.WriteString("\n")
+	}
+	return influxBuffer.String()
+}
+
+// one lifecycle stage of a nodeclaim timeline, deltaFromPrevious is in seconds
+type timelinestage struct {
+	Stage             string  `json:"stage"`
+	Time              string  `json:"time"`
+	DeltaFromPrevious float64 `json:"deltaFromPrevious"`
+}
+
+// ConvertToTimeline converts nodeclaimmap to a JSON array of nodeclaims with a timeline array of their lifecycle stages
+// stages which did not occur are omitted
+func ConvertToTimeline(nodeclaimmap *map[string]Nodeclaimstruct) string {
+	type timelinenodeclaim struct {
+		Nodeclaim string          `json:"nodeclaim"`
+		Timeline  []timelinestage `json:"timeline"`
+	}
+	timelines := []timelinenodeclaim{}
+	for _, v := range sortLimitResult(nodeclaimmap) {
+		timeline := []timelinestage{}
+		var previous time.Time
+		for _, stage := range [][2]string{{"created", v.value.Createdtime}, {"launched", v.value.Launchedtime}, {"registered", v.value.Registeredtime}, {"initialized", v.value.Initializedtime}, {"disrupted", v.value.Disruptiontime}, {"deleted", v.value.Deletedtime}} {
+			if stage[1] == "" {
+				continue
+			}
+			entry := timelinestage{Stage: stage[0], Time: stage[1]}
+			if stagetime, err := time.Parse(time.RFC3339Nano, stage[1]); err == nil {
+				if !previous.IsZero() {
+					entry.DeltaFromPrevious = float64(stagetime.Sub(previous).Milliseconds()) / 1000
+				}
+				previous = stagetime
+			}
+			timeline = append(timeline, entry)
+		}
+		timelines = append(timelines, timelinenodeclaim{Nodeclaim: v.key, Timeline: timeline})
+	}
+	val, err := json.MarshalIndent(timelines, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "JSON encoding error while encoding timelines - %s\n", err.Error())
+		return ""
+	}
+	return string(val) + "\n"
+}
+
+// ConvertToGantt converts nodeclaimmap to a Mermaid gantt diagram with one section per nodeclaim
+// each nodeclaim is a task from Createdtime to Deletedtime with milestones for launch, registration and initialization
+// nodeclaims which are not deleted end at the latest timestamp of all nodeclaims, nodeclaims without Createdtime are omitted
+func ConvertToGantt(nodeclaimmap *map[string]Nodeclaimstruct) string {
+	const ganttformat = "2006-01-02 15:04:05.000"
+	var ganttBuffer bytes.Buffer
+	s := sortLimitResult(nodeclaimmap)
+	// determine end of running nodeclaims
+	var latesttime time.Time
+	for _, v := range s {
+		for _, stagetime := range []string{v.value.Createdtime, v.value.Launchedtime, v.value.Registeredtime, v.value.Initializedtime, v.value.Disruptiontime, v.value.Deletedtime} {
+			if t, err := time.Parse(time.RFC3339Nano, stagetime); err == nil && t.After(latesttime) {
+				latesttime = t
+			}
+		}
+	}
+	ganttBuffer.WriteString("gantt\n    title Karpenter nodeclaims\n    dateFormat YYYY-MM-DD HH:mm:ss.SSS\n    axisFormat %H:%M\n")
+	for _, v := range s {
+		created, err := time.Parse(time.RFC3339Nano, v.value.Createdtime)
+		if err != nil {
+			continue
+		}
+		end := latesttime
+		if deleted, err := time.Parse(time.RFC3339Nano, v.value.Deletedtime); err == nil {
+			end = deleted
+		}
+		task := v.value.Nodepool
+		if task == "" {
+			task = "lifecycle"
+		}
+		fmt.Fprintf(&ganttBuffer, "    section %s\n", v.key)
+		fmt.Fprintf(&ganttBuffer, "    %s :%s, %s\n", task, created.UTC().Format(ganttformat), end.UTC().Format(ganttformat))
+		for _, stage := range [][2]string{{"launched", v.value.Launchedtime}, {"registered", v.value.Registeredtime}, {"initialized", v.value.Initializedtime}} {
+			if stagetime, err := time.Parse(time.RFC3339Nano, stage[1]); err == nil {
+				fmt.Fprintf(&ganttBuffer, "    %s :milestone, %s, 0d\n", stage[0], stagetime.UTC().Format(ganttformat))
+			}
+		}
+	}
+	return ganttBuffer.String()
+}
+
+// ConvertToTemplate executes the LP4K_TEMPLATE template for every sorted nodeclaim, each followed by a newline
+// template execution errors are reported per nodeclaim and the nodeclaim is skipped
+func ConvertToTemplate(nodeclaimmap *map[string]Nodeclaimstruct) string {
+	var templateBuffer, recordBuffer bytes.Buffer
+	for _, v := range sortLimitResult(nodeclaimmap) {
+		recordBuffer.Reset()
+		if err := outputtemplate.Execute(&recordBuffer, templatedata{Nodeclaim: v.key, Nodeclaimstruct: v.value}); err != nil {
+			fmt.Fprintf(os.Stderr, "Template error for nodeclaim \"%s\" - %s\n", v.key, err.Error())
+			continue
+		}
+		templateBuffer.Write(recordBuffer.Bytes())
+		templateBuffer.WriteString("\n")
+	}
+	return templateBuffer.String()
+}
+
+// ConvertResult is used by k8s package to create ConfigMap data, with LP4K_CM_COMPACT=true zero-value fields are omitted
+// nodeclaims which are no valid ConfigMap keys are skipped and returned separately, so callers can report them
+func ConvertResult(nodeclaimmap *map[string]Nodeclaimstruct) (map[string]string, []string) {
 	keyvalueMap := make(map[string]string)
+	var skipped []string
 	if len((*nodeclaimmap)) == 0 {
 		fmt.Fprintf(os.Stderr, "\nNo results - empty \"nodeclaim\" map\n")
-		return keyvalueMap
+		return keyvalueMap, skipped
 	}
 	s := sortResult(nodeclaimmap)
 	for _, v := range s {
-		if jsondata, err := json.Marshal(v.value); err == nil {
+		if !isConfigMapKey(v.key) {
+			skipped = append(skipped, v.key)
+			continue
+		}
+		marshal := json.Marshal
+		if cmcompact || cmfields != nil {
+			marshal = marshalCompact
+		}
+		if jsondata, err := marshal(v.value); err == nil {
 			keyvalueMap[v.key] = string(jsondata)
 		} else {
 			fmt.Fprintf(os.Stderr, "JSON encoding error while encoding Nodeclaimstruct of nodeclaim \"%s\\n", v.key)
 		}
 	}
-	return keyvalueMap
+	return keyvalueMap, skipped
+}
+
+// internal helper function to marshal a Nodeclaimstruct like json.Marshal but with omitempty semantics for all fields if LP4K_CM_COMPACT=true
+// and only the fields of LP4K_CM_FIELDS if set, omitted fields are restored as zero values by json.Unmarshal, so Populatenodeclaimmap reads all formats
+func marshalCompact(v any) ([]byte, error) {
+	var objBuffer bytes.Buffer
+
+	reflectval := reflect.ValueOf(v)
+	reflecttype := reflectval.Type()
+	objBuffer.WriteString("{")
+	for i := range reflectval.NumField() {
+		if (cmcompact && reflectval.Field(i).IsZero()) || (cmfields != nil && !cmfields[reflecttype.Field(i).Name]) {
+			continue
+		}
+		val, err := json.Marshal(reflectval.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if objBuffer.Len() > 1 {
+			objBuffer.WriteString(",")
+		}
+		fmt.Fprintf(&objBuffer, `"%s":%s`, reflecttype.Field(i).Name, val)
+	}
+	objBuffer.WriteString("}")
+
+	return objBuffer.Bytes(), nil
+}
+
+// internal helper function to check if key is a valid ConfigMap data key i.e. consists of alphanumeric characters, '-', '_' or '.' only
+func isConfigMapKey(key string) bool {
+	return len(key) <= 253 && configmapKeyPattern.MatchString(key)
 }
@@ -0,0 +1,404 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// internal helper function to parse the sample Karpenter log into a nodeclaim map and a K8s node name map
+func parseSampleInput(t *testing.T) (map[string]Nodeclaimstruct, map[string]string) {
+	t.Helper()
+	nodeclaimmap := make(map[string]Nodeclaimstruct)
+	k8snodenamemap := make(map[string]string)
+	if err := NewParserWithOptions(Options{}).ParseFile("../sample-input.txt", &nodeclaimmap, &k8snodenamemap); err != nil {
+		t.Fatalf("failed to parse sample input: %v", err)
+	}
+	if len(nodeclaimmap) == 0 {
+		t.Fatalf("no nodeclaims parsed from sample input")
+	}
+	return nodeclaimmap, k8snodenamemap
+}
+
+func TestConvertResultCompactRoundTrip(t *testing.T) {
+	nodeclaimmap, _ := parseSampleInput(t)
+
+	defer func(compact bool) { cmcompact = compact }(cmcompact)
+	cmcompact = false
+	full, _ := ConvertResult(&nodeclaimmap)
+	cmcompact = true
+	compact, _ := ConvertResult(&nodeclaimmap)
+
+	for k := range full {
+		if len(compact[k]) >= len(full[k]) {
+			t.Errorf("compact data of nodeclaim %q is not smaller: %d >= %d bytes", k, len(compact[k]), len(full[k]))
+		}
+	}
+	readmap := make(map[string]Nodeclaimstruct)
+	Populatenodeclaimmap(&readmap, compact)
+	if !reflect.DeepEqual(readmap, nodeclaimmap) {
+		t.Errorf("compact round trip differs\ngot:  %v\nwant: %v", readmap, nodeclaimmap)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	if got, want := Header(false, []string{"Createdtime", "Nodepool"}), keyname+",Createdtime,Nodepool"; got != want {
+		t.Errorf("expected header %q, got %q", want, got)
+	}
+	if got, want := Header(true, []string{"Instancetype"}), keyname+"[1],Instancetype[2]"; got != want {
+		t.Errorf("expected header %q, got %q", want, got)
+	}
+	if got := Header(true, nil); got != header {
+		t.Errorf("expected full header %q, got %q", header, got)
+	}
+}
+
+func TestFormatValueDisplayTZ(t *testing.T) {
+	defer func(tz *time.Location) { displaytz = tz }(displaytz)
+	var err error
+	if displaytz, err = time.LoadLocation("America/New_York"); err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	if got, want := formatValue(reflect.ValueOf("2025-04-23T15:05:58.670Z")), "2025-04-23T11:05:58.670-04:00"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := formatValue(reflect.ValueOf("default")), "default"; got != want {
+		t.Errorf("expected non-timestamp %q unchanged, got %q", want, got)
+	}
+}
+
+func TestPopulatek8snodenamemap(t *testing.T) {
+	nodeclaimmap, k8snodenamemap := parseSampleInput(t)
+
+	derived := make(map[string]string)
+	Populatek8snodenamemap(&nodeclaimmap, &derived)
+	if !reflect.DeepEqual(derived, k8snodenamemap) {
+		t.Errorf("derived K8s node names differ from parsed ones\ngot:  %v\nwant: %v", derived, k8snodenamemap)
+	}
+}
+
+func TestFilterNodeclaimsExcludeNodepool(t *testing.T) {
+	defer func(patterns []string) { excludenodepools = patterns }(excludenodepools)
+	excludenodepools = []string{"system", "critical-*"}
+	nodeclaimmap := map[string]Nodeclaimstruct{
+		"system-abcde":     {Nodepool: "system"},
+		"critical-a-fghij": {Nodepool: "critical-a"},
+		"default-klmno":    {Nodepool: "default"},
+	}
+	FilterNodeclaims(&nodeclaimmap, "", "")
+	if _, ok := nodeclaimmap["default-klmno"]; len(nodeclaimmap) != 1 || !ok {
+		t.Errorf("expected only nodeclaim default-klmno, got %v", nodeclaimmap)
+	}
+}
+
+// sink recording the nodeclaims of its last write
+type recordingSink struct {
+	nodeclaimmap *map[string]Nodeclaimstruct
+}
+
+func (*recordingSink) Name() string {
+	return "recording"
+}
+
+func (s *recordingSink) Write(nodeclaimmap *map[string]Nodeclaimstruct) error {
+	s.nodeclaimmap = nodeclaimmap
+	return nil
+}
+
+func TestWriteSinksExcludeNodepool(t *testing.T) {
+	defer func(patterns []string) { excludenodepools = patterns }(excludenodepools)
+	excludenodepools = []string{"system"}
+	nodeclaimmap := map[string]Nodeclaimstruct{
+		"system-abcde":  {Nodepool: "system"},
+		"default-klmno": {Nodepool: "default"},
+	}
+	// stream mode writes store snapshots to sinks without FilterNodeclaims
+	sink := &recordingSink{}
+	WriteSinks([]Sink{sink}, &nodeclaimmap)
+	if _, ok := (*sink.nodeclaimmap)["default-klmno"]; len(*sink.nodeclaimmap) != 1 || !ok {
+		t.Errorf("expected only nodeclaim default-klmno written, got %v", *sink.nodeclaimmap)
+	}
+	if len(nodeclaimmap) != 2 {
+		t.Errorf("expected written nodeclaims unchanged, got %v", nodeclaimmap)
+	}
+}
+
+func TestP2Quantile(t *testing.T) {
+	estimators := newReadyQuantiles()
+	// 1..1000 in shuffled order via a stride coprime to 1000
+	for i := 0; i < 1000; i++ {
+		for _, p := range estimators {
+			p.add(float64(i*337%1000 + 1))
+		}
+	}
+	for i, q := range Quantiles {
+		if got, expected := estimators[i].value(), q*1000; got < expected*0.95 || got > expected*1.05 {
+			t.Errorf("quantile %g: expected about %g, got %g", q, expected, got)
+		}
+	}
+
+	// less than five observations are exact
+	p := newReadyQuantiles()[0]
+	for _, x := range []float64{30, 10, 20} {
+		p.add(x)
+	}
+	if got := p.value(); got != 20 {
+		t.Errorf("expected exact median 20, got %g", got)
+	}
+}
+
+func TestFilterNodeclaimsActiveAt(t *testing.T) {
+	defer func(at time.Time) { activeat = at }(activeat)
+	activeat = time.Date(2025, 4, 23, 14, 30, 0, 0, time.UTC)
+	nodeclaimmap := map[string]Nodeclaimstruct{
+		"default-before": {Createdtime: "2025-04-23T13:00:00.000Z", Deletedtime: "2025-04-23T14:00:00.000Z"},
+		"default-during": {Createdtime: "2025-04-23T14:00:00.000Z", Deletedtime: "2025-04-23T15:00:00.000Z"},
+		"default-active": {Createdtime: "2025-04-23T14:29:59.999Z"},
+		"default-after":  {Createdtime: "2025-04-23T14:30:00.001Z"},
+	}
+	FilterNodeclaims(&nodeclaimmap, "", "")
+	if len(nodeclaimmap) != 2 || nodeclaimmap["default-during"].Createdtime == "" || nodeclaimmap["default-active"].Createdtime == "" {
+		t.Errorf("expected nodeclaims default-during and default-active, got %v", nodeclaimmap)
+	}
+}
+
+func TestWriteSinksActiveAt(t *testing.T) {
+	defer func(at time.Time) { activeat = at }(activeat)
+	activeat = time.Date(2025, 4, 23, 14, 30, 0, 0, time.UTC)
+	nodeclaimmap := map[string]Nodeclaimstruct{
+		"default-before": {Createdtime: "2025-04-23T13:00:00.000Z", Deletedtime: "2025-04-23T14:00:00.000Z"},
+		"default-active": {Createdtime: "2025-04-23T14:00:00.000Z"},
+	}
+	sink := &recordingSink{}
+	WriteSinks([]Sink{sink}, &nodeclaimmap)
+	if _, ok := (*sink.nodeclaimmap)["default-active"]; len(*sink.nodeclaimmap) != 1 || !ok {
+		t.Errorf("expected only nodeclaim default-active written, got %v", *sink.nodeclaimmap)
+	}
+	// the ConfigMap sink renders with ConvertResult
+	if data, _ := ConvertResult(sink.nodeclaimmap); len(data) != 1 || data["default-active"] == "" {
+		t.Errorf("expected only nodeclaim default-active in ConfigMap data, got %v", data)
+	}
+}
+
+func TestConvertResultFields(t *testing.T) {
+	defer func(fields map[string]bool) { cmfields = fields }(cmfields)
+	cmfields = map[string]bool{"Nodepool": true, "Nodereadytimesec": true}
+	nodeclaimmap := map[string]Nodeclaimstruct{"default-abcde": {Createdtime: "2025-04-23T15:05:58.670Z", Nodepool: "default", Nodereadytimesec: 61.3}}
+	cmdata, _ := ConvertResult(&nodeclaimmap)
+	if got, want := cmdata["default-abcde"], `{"Nodepool":"default","Nodereadytimesec":61.3}`; got != want {
+		t.Errorf("expected ConfigMap data %s, got %s", want, got)
+	}
+	readmap := make(map[string]Nodeclaimstruct)
+	Populatenodeclaimmap(&readmap, cmdata)
+	if got := readmap["default-abcde"]; got.Nodepool != "default" || got.Nodereadytimesec != 61.3 || got.Createdtime != "" {
+		t.Errorf("unexpected nodeclaim read back %+v", got)
+	}
+}
+
+func TestConvertOutputJSON(t *testing.T) {
+	defer func(format string) { outputformat = format }(outputformat)
+	outputformat = "json"
+	nodeclaimmap := map[string]Nodeclaimstruct{
+		"default-abcde": {Createdtime: "2025-04-23T15:05:58.670Z", Nodepool: "default", Nodereadytimesec: 61.3, Initialized: true},
+		"default-fghij": {Createdtime: "2025-04-23T15:06:00.000Z", Nodepool: "default"},
+	}
+	var nodeclaims []map[string]any
+	if err := json.Unmarshal([]byte(ConvertOutput(&nodeclaimmap)), &nodeclaims); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if len(nodeclaims) != 2 {
+		t.Fatalf("expected 2 nodeclaims, got %d", len(nodeclaims))
+	}
+	// sorted by Createdtime like CSV
+	if nodeclaims[0][keyname] != "default-abcde" || nodeclaims[0]["Nodereadytimesec"] != 61.3 || nodeclaims[0]["Initialized"] != true {
+		t.Errorf("unexpected first nodeclaim %v", nodeclaims[0])
+	}
+}
+
+func TestConvertToParquet(t *testing.T) {
+	nodeclaimmap := map[string]Nodeclaimstruct{"default-abcde": {Createdtime: "2025-04-23T15:05:58.670Z", Nodepool: "default", Nodereadytimesec: 61.3, Initialized: true}}
+	file := ConvertToParquet(&nodeclaimmap)
+	if !strings.HasPrefix(file, parquetMagic) || !strings.HasSuffix(file, parquetMagic) {
+		t.Fatalf("missing Parquet magic")
+	}
+	footer := int(binary.LittleEndian.Uint32([]byte(file[len(file)-8 : len(file)-4])))
+	if footer <= 0 || footer > len(file)-12 {
+		t.Fatalf("invalid Parquet footer length %d of %d bytes", footer, len(file))
+	}
+	// the PLAIN encoded key column starts right after the first page header with the 4 byte length of the nodeclaim name
+	if !strings.Contains(file, "\x0d\x00\x00\x00default-abcde") {
+		t.Errorf("nodeclaim name not PLAIN encoded in Parquet data")
+	}
+	meta := file[len(file)-8-footer : len(file)-8]
+	for _, column := range []string{keyname, "Createdtime", "Nodereadytimesec", "Initialized"} {
+		if !strings.Contains(meta, column) {
+			t.Errorf("column %s missing in Parquet schema", column)
+		}
+	}
+}
+
+// reader of Thrift compact protocol structs, the counterpart of thriftWriter to verify the structure of written Parquet files
+// structs are decoded into maps by field ID, integers into int64, binaries into strings and lists into slices
+type thriftReader struct {
+	t    *testing.T
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) varint() int64 {
+	val, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("invalid Thrift varint at offset %d", r.pos)
+	}
+	r.pos += n
+	return val
+}
+
+func (r *thriftReader) uvarint() int {
+	val, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("invalid Thrift varint at offset %d", r.pos)
+	}
+	r.pos += n
+	return int(val)
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.t.Fatalf("truncated Thrift data at offset %d", r.pos)
+	}
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+// internal helper function to decode a value of a Thrift compact protocol type
+func (r *thriftReader) value(valtype byte) any {
+	switch valtype {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		size := r.uvarint()
+		if r.pos+size > len(r.data) {
+			r.t.Fatalf("truncated Thrift binary at offset %d", r.pos)
+		}
+		r.pos += size
+		return string(r.data[r.pos-size : r.pos])
+	case thriftList:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = r.uvarint()
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.t.Fatalf("unexpected Thrift type %d at offset %d", valtype, r.pos)
+	return nil
+}
+
+// internal helper function to decode a struct until its stop field
+func (r *thriftReader) structure() map[int]any {
+	fields := make(map[int]any)
+	var id int
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int(header >> 4); delta > 0 {
+			id += delta
+		} else {
+			id = int(r.varint())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+}
+
+func TestConvertToParquetStructure(t *testing.T) {
+	nodeclaimmap := map[string]Nodeclaimstruct{
+		"default-abcde": {Createdtime: "2025-04-23T15:05:58.670Z", Nodepool: "default", Nodereadytimesec: 61.3, Initialized: true},
+		"default-fghij": {Createdtime: "2025-04-23T15:06:58.670Z", Nodepool: "default"},
+	}
+	data := []byte(ConvertToParquet(&nodeclaimmap))
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8 : len(data)-4]))
+	metastart := len(data) - 8 - footer
+	reader := &thriftReader{t: t, data: data[:len(data)-8], pos: metastart}
+	meta := reader.structure()
+	if reader.pos != len(data)-8 {
+		t.Fatalf("FileMetaData ends at offset %d instead of footer at %d", reader.pos, len(data)-8)
+	}
+	if meta[3] != int64(2) {
+		t.Errorf("expected num_rows 2, got %v", meta[3])
+	}
+
+	// schema root followed by one required column per CSV column with the physical type of its field
+	schema := meta[2].([]any)
+	names := strings.Split(Header(false, nil), ",")
+	if root := schema[0].(map[int]any); root[5] != int64(len(names)) || len(schema) != len(names)+1 {
+		t.Fatalf("expected schema root with %d columns, got %v and %d elements", len(names), root, len(schema))
+	}
+	types := map[string]int64{keyname: parquetByteArray, "Createdtime": parquetByteArray, "Nodereadytimesec": parquetDouble, "Initialized": parquetBoolean}
+	for i, name := range names {
+		element := schema[i+1].(map[int]any)
+		if element[4] != name || element[3] != int64(parquetRequired) {
+			t.Errorf("expected required column %s at %d, got %v", name, i, element)
+		}
+		if want, ok := types[name]; ok && element[1] != want {
+			t.Errorf("expected type %d of column %s, got %v", want, name, element[1])
+		}
+		if _, utf8 := element[6]; utf8 != (element[1] == int64(parquetByteArray)) {
+			t.Errorf("expected UTF8 converted type for byte array columns only, got %v for %s", element, name)
+		}
+	}
+
+	// one row group whose column chunks are single data pages laid out back to back between magic and FileMetaData
+	rowgroups := meta[4].([]any)
+	if len(rowgroups) != 1 {
+		t.Fatalf("expected one row group, got %d", len(rowgroups))
+	}
+	rowgroup := rowgroups[0].(map[int]any)
+	chunks := rowgroup[1].([]any)
+	if len(chunks) != len(names) || rowgroup[3] != int64(2) {
+		t.Fatalf("expected %d column chunks of 2 rows, got %d of %v", len(names), len(chunks), rowgroup[3])
+	}
+	offset, total := int64(len(parquetMagic)), int64(0)
+	for i, chunk := range chunks {
+		columnmeta := chunk.(map[int]any)[3].(map[int]any)
+		if chunk.(map[int]any)[2] != offset || columnmeta[9] != offset {
+			t.Fatalf("expected column %s at offset %d, got file_offset %v and data_page_offset %v", names[i], offset, chunk.(map[int]any)[2], columnmeta[9])
+		}
+		if columnmeta[1] != schema[i+1].(map[int]any)[1] || columnmeta[3].([]any)[0] != names[i] || columnmeta[5] != int64(2) {
+			t.Errorf("column chunk %d does not match schema column %s: %v", i, names[i], columnmeta)
+		}
+		page := &thriftReader{t: t, data: data[:metastart], pos: int(offset)}
+		pageheader := page.structure()
+		datapage := pageheader[5].(map[int]any)
+		if pageheader[1] != int64(parquetDataPage) || datapage[1] != int64(2) || datapage[2] != int64(parquetPlain) {
+			t.Errorf("unexpected page header of column %s: %v", names[i], pageheader)
+		}
+		pagesize := pageheader[3].(int64)
+		size := int64(page.pos) - offset + pagesize
+		if columnmeta[6] != size || columnmeta[7] != size || pageheader[2] != pagesize {
+			t.Errorf("expected column %s of %d bytes, got %v", names[i], size, columnmeta)
+		}
+		// PLAIN encoded values start right after the page header, the key column with the length of the first nodeclaim name
+		if i == 0 && string(data[page.pos+4:page.pos+4+13]) != "default-abcde" {
+			t.Errorf("expected first nodeclaim name after page header of column %s", names[i])
+		}
+		offset += size
+		total += size
+	}
+	if offset != int64(metastart) || rowgroup[2] != total {
+		t.Errorf("expected column chunks to end at FileMetaData offset %d with total size %v, got %d and %d", metastart, rowgroup[2], offset, total)
+	}
+}
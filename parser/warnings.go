@@ -0,0 +1,81 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package parser
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const (
+	// environment variable
+	warningsEnv = "LP4K_WARNINGS"
+)
+
+// structured logger for parse warnings and errors, nil if LP4K_WARNINGS is not set
+var warnlogger *slog.Logger
+
+// file of LP4K_WARNINGS, nil if LP4K_WARNINGS is not set or "stderr"
+var warnfile *os.File
+
+// internal helper function to determine structured warning output via OS environment
+// "stderr" logs JSON records to STDERR, any other value is a file, which is appended to
+func init() {
+	val := os.Getenv(warningsEnv)
+	switch val {
+	case "":
+		return
+	case "stderr":
+		warnlogger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	default:
+		file, err := os.OpenFile(val, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid environment variable %s - %s\n", warningsEnv, err.Error())
+			os.Exit(1)
+		}
+		warnfile = file
+		warnlogger = slog.New(slog.NewJSONHandler(file, nil))
+	}
+}
+
+// CloseWarnings syncs and closes the LP4K_WARNINGS file at shutdown, warnings of still running parsers are dropped afterwards
+func CloseWarnings() {
+	if warnfile == nil {
+		return
+	}
+	if err := warnfile.Sync(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to sync %s file \"%s\": %v\n", warningsEnv, warnfile.Name(), err)
+	}
+	if err := warnfile.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to close %s file \"%s\": %v\n", warningsEnv, warnfile.Name(), err)
+	}
+	warnfile = nil
+}
+
+// internal helper function to emit a parse warning as structured JSON record with line number, Karpenter message, filename, reason and raw logline
+func logWarning(level slog.Level, message string, reason string, logline string, inputline int, filename string) {
+	if warnlogger == nil {
+		return
+	}
+	warnlogger.Log(context.Background(), level, "parse warning",
+		slog.Int("line", inputline),
+		slog.String("message", message),
+		slog.String("file", filename),
+		slog.String("reason", reason),
+		slog.String("raw", logline))
+}
+
+// internal helper function to report a Karpenter log line whose message is known, but whose fields could not be extracted
+// field is the empty field like "NodeClaim", or empty if the whole logline did not match
+func parsingError(message string, field string, logline string, inputline int, filename string) {
+	reason := "no match"
+	if field != "" {
+		fmt.Fprintf(os.Stderr, "Parsing error empty \"%s\" for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", field, message, inputline, filename)
+		reason = fmt.Sprintf("empty %s", field)
+	} else {
+		fmt.Fprintf(os.Stderr, "Parsing error for message \"%s\" in line %d in %s, probably Karpenter log syntax has changed!\n", message, inputline, filename)
+	}
+	logWarning(slog.LevelError, message, reason, logline, inputline, filename)
+}
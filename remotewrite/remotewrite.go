@@ -0,0 +1,255 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/nav-inc/datetime"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+)
+
+const (
+	// environment variables
+	remotewriteURLEnv    = "LP4K_REMOTE_WRITE_URL"
+	remotewriteBatchEnv  = "LP4K_REMOTE_WRITE_BATCH"
+	remotewriteRegionEnv = "LP4K_REMOTE_WRITE_SIGV4_REGION"
+	// timeout of a single remote-write request
+	writeTimeout = 30 * time.Second
+)
+
+var remotewriteURL, remotewriteRegion string
+var remotewriteBatch int
+var remotewriteEnabled bool
+
+// series already pushed, so repeated sink writes in cluster mode only push new samples
+var sentmutex sync.Mutex
+var sent = make(map[string]bool)
+
+// one sample of one series, labels are sorted by name as required by remote-write
+type timeseries struct {
+	key       string
+	labels    [][2]string
+	value     float64
+	timestamp int64
+}
+
+// Initialize remote-write configuration from environment variables
+func init() {
+	remotewriteURL = os.Getenv(remotewriteURLEnv)
+	remotewriteEnabled = remotewriteURL != ""
+	if !remotewriteEnabled {
+		return
+	}
+	var err error
+	if remotewriteBatch, err = strconv.Atoi(getEnvOrDefault(remotewriteBatchEnv, "500")); err != nil || remotewriteBatch <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid environment variable %s, must be a positive number of series per request\n", remotewriteBatchEnv)
+		os.Exit(1)
+	}
+	remotewriteRegion = os.Getenv(remotewriteRegionEnv)
+	fmt.Fprintf(os.Stderr, "Prometheus remote-write enabled: url=%s\n", remotewriteURL)
+}
+
+func getEnvOrDefault(key, defaultVal string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return defaultVal
+}
+
+// IsEnabled returns whether Prometheus remote-write is configured via LP4K_REMOTE_WRITE_URL
+func IsEnabled() bool {
+	return remotewriteEnabled
+}
+
+// internal helper function to build one sample per metric of every nodeclaim with Createdtime as timestamp
+// metrics of a nodeclaim are only built once their lifecycle stage is reached, series pushed before are skipped
+func buildSeries(nodeclaimmap *map[string]lp4k.Nodeclaimstruct) []timeseries {
+	var series []timeseries
+	for k, v := range *nodeclaimmap {
+		created, err := datetime.Parse(v.Createdtime, time.UTC)
+		if err != nil {
+			continue
+		}
+		metrics := []struct {
+			name  string
+			value float64
+			ok    bool
+		}{
+			{"lp4k_nodeclaim_ready_seconds", v.Nodereadytimesec, v.Initialized && v.Initializedtime != ""},
+			{"lp4k_nodeclaim_boot_ready_seconds", v.Bootreadytimesec, v.Initialized && v.Launchedtime != "" && v.Initializedtime != ""},
+			{"lp4k_nodeclaim_lifecycle_seconds", v.Nodelifecycletimesec, v.Deleted && v.Deletedtime != ""},
+		}
+		for _, m := range metrics {
+			key := m.name + "/" + k
+			if !m.ok || sent[key] {
+				continue
+			}
+			series = append(series, timeseries{
+				key: key,
+				labels: [][2]string{
+					{"__name__", m.name},
+					{"capacity_type", v.Capacitytype},
+					{"instance_type", v.Instancetype},
+					{"nodeclaim", k},
+					{"nodepool", v.Nodepool},
+					{"zone", v.Zone},
+				},
+				value:     m.value,
+				timestamp: created.UnixMilli(),
+			})
+		}
+	}
+	// oldest samples first, so receivers accepting out-of-order samples within a window get them in order
+	sort.SliceStable(series, func(i, j int) bool { return series[i].timestamp < series[j].timestamp })
+	return series
+}
+
+// internal helper function to encode series as prompb.WriteRequest protobuf message
+func encodeWriteRequest(series []timeseries) []byte {
+	var request []byte
+	for _, s := range series {
+		var ts []byte
+		for _, label := range s.labels {
+			// empty label values are equal to a missing label
+			if label[1] == "" {
+				continue
+			}
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, label[0])
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, label[1])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, ts)
+	}
+	return request
+}
+
+// internal helper function to encode data in snappy block format as a single literal without compression
+// this is valid snappy any decoder accepts and avoids a compression dependency for small requests
+func snappyLiteral(data []byte) []byte {
+	block := binary.AppendUvarint(nil, uint64(len(data)))
+	if len(data) == 0 {
+		return block
+	}
+	// literal tag, literals of up to 60 bytes store their length in the tag byte itself, longer ones in 4 following bytes
+	if n := len(data) - 1; n < 60 {
+		block = append(block, byte(n)<<2)
+	} else {
+		block = append(block, 63<<2)
+		block = binary.LittleEndian.AppendUint32(block, uint32(n))
+	}
+	return append(block, data...)
+}
+
+// PushMetrics pushes node ready, boot ready and lifecycle time of all nodeclaims with Createdtime as sample timestamp via Prometheus remote-write
+// samples are sent in batches of LP4K_REMOTE_WRITE_BATCH series, every series is pushed only once
+func PushMetrics(nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
+	if !remotewriteEnabled {
+		return nil
+	}
+	sentmutex.Lock()
+	defer sentmutex.Unlock()
+	series := buildSeries(nodeclaimmap)
+	for len(series) > 0 {
+		batch := series[:min(len(series), remotewriteBatch)]
+		series = series[len(batch):]
+		if err := send(snappyLiteral(encodeWriteRequest(batch))); err != nil {
+			return err
+		}
+		for _, s := range batch {
+			sent[s.key] = true
+		}
+	}
+	return nil
+}
+
+// internal function to send one snappy compressed WriteRequest, signed with SigV4 for Amazon Managed Service for Prometheus if LP4K_REMOTE_WRITE_SIGV4_REGION is set
+func send(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, remotewriteURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if remotewriteRegion != "" {
+		cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(remotewriteRegion))
+		if err != nil {
+			return fmt.Errorf("unable to load AWS SDK config: %w", err)
+		}
+		creds, err := cfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to retrieve AWS credentials: %w", err)
+		}
+		payloadhash := sha256.Sum256(body)
+		if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(payloadhash[:]), "aps", remotewriteRegion, time.Now()); err != nil {
+			return fmt.Errorf("unable to sign remote-write request: %w", err)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to remote-write: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to remote-write: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Sink pushes nodeclaim metrics via Prometheus remote-write on every write
+type Sink struct{}
+
+func (Sink) Name() string {
+	return "remotewrite"
+}
+
+func (Sink) Write(nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
+	return PushMetrics(nodeclaimmap)
+}
+
+// NewSink returns the remote-write sink or nil if remote-write is disabled
+// the remote-write sink is enabled by default if LP4K_REMOTE_WRITE_URL is set
+func NewSink() lp4k.Sink {
+	if !lp4k.SinkEnabled("remotewrite", remotewriteEnabled) {
+		return nil
+	}
+	if !remotewriteEnabled {
+		fmt.Fprintf(os.Stderr, "Warning: remotewrite sink requires environment variable %s - remotewrite sink disabled\n", remotewriteURLEnv)
+		return nil
+	}
+	return Sink{}
+}
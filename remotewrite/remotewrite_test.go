@@ -0,0 +1,85 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package remotewrite
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
+)
+
+// internal helper function to decode a snappy block consisting of a single literal like snappyLiteral encodes it
+func decodeSnappyLiteral(t *testing.T, block []byte) []byte {
+	t.Helper()
+	length, n := binary.Uvarint(block)
+	block = block[n:]
+	switch tag := block[0] >> 2; {
+	case tag < 60:
+		block = block[1:]
+	case tag == 63:
+		block = block[5:]
+	default:
+		t.Fatalf("unexpected snappy literal tag %d", tag)
+	}
+	if uint64(len(block)) != length {
+		t.Fatalf("expected %d bytes of snappy literal, got %d", length, len(block))
+	}
+	return block
+}
+
+func TestPushMetrics(t *testing.T) {
+	var requests [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected remote-write headers %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, decodeSnappyLiteral(t, body))
+	}))
+	defer server.Close()
+
+	defer func(url string, batch int, enabled bool) {
+		remotewriteURL, remotewriteBatch, remotewriteEnabled = url, batch, enabled
+		sent = make(map[string]bool)
+	}(remotewriteURL, remotewriteBatch, remotewriteEnabled)
+	remotewriteURL, remotewriteBatch, remotewriteEnabled = server.URL, 2, true
+
+	nodeclaimmap := map[string]lp4k.Nodeclaimstruct{
+		"default-abcde": {Createdtime: "2025-04-23T15:05:58.670Z", Nodepool: "default", Initializedtime: "2025-04-23T15:07:00.000Z", Initialized: true, Nodereadytimesec: 61.33, Launchedtime: "2025-04-23T15:06:01.559Z", Bootreadytimesec: 58.44},
+		"default-fghij": {Createdtime: "2025-04-23T15:06:00.000Z", Nodepool: "default"},
+	}
+	if err := PushMetrics(&nodeclaimmap); err != nil {
+		t.Fatalf("PushMetrics failed: %v", err)
+	}
+	// two series of the initialized nodeclaim in one batch, the other nodeclaim has no metrics yet
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	var series int
+	for b := requests[0]; len(b) > 0; {
+		num, typ, n := protowire.ConsumeTag(b)
+		if num != 1 || typ != protowire.BytesType {
+			t.Fatalf("unexpected WriteRequest field %d type %d", num, typ)
+		}
+		_, m := protowire.ConsumeBytes(b[n:])
+		b = b[n+m:]
+		series++
+	}
+	if series != 2 {
+		t.Errorf("expected 2 series, got %d", series)
+	}
+
+	// already pushed series are not pushed again
+	if err := PushMetrics(&nodeclaimmap); err != nil {
+		t.Fatalf("PushMetrics failed: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("expected no further request, got %d requests", len(requests))
+	}
+}
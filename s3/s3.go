@@ -110,7 +110,7 @@ func GetStartTimestamp() string {
 	return startTimestamp
 }
 
-// UploadToS3 uploads the nodeclaim CSV data to S3 with timeout and context cancellation support
+// UploadToS3 uploads the nodeclaim CSV (or Parquet) data to S3 with timeout and context cancellation support
 // The S3 client is cached and reused across multiple calls for efficiency
 // If LP4K_S3_OVERWRITE=true, the same object is overwritten on each call
 // Otherwise, a new timestamped object is created on each call
@@ -126,24 +126,34 @@ func UploadToS3(nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
 	if err != nil {
 		return err
 	}
-	// Convert nodeclaimmap to CSV
-	csvData := lp4k.ConvertToCSV(nodeclaimmap)
+	// Convert nodeclaimmap to CSV or Parquet if LP4K_OUTPUT_FORMAT=parquet, gzip compressed if LP4K_OUTPUT_GZIP=true
+	data, extension, contentType := lp4k.ConvertToCSV(nodeclaimmap), "csv", "text/csv"
+	if lp4k.OutputFormat() == "parquet" {
+		data, extension, contentType = lp4k.ConvertToParquet(nodeclaimmap), "parquet", "application/vnd.apache.parquet"
+	}
+	uploadData, suffix, err := lp4k.CompressOutput([]byte(data))
+	if err != nil {
+		return fmt.Errorf("failed to compress S3 upload: %w", err)
+	}
+	if suffix != "" {
+		contentType = "application/gzip"
+	}
 	// Generate S3 key
 	var s3Key string
 	if s3Overwrite {
 		// Use start timestamp for overwrite mode (same key on each update)
-		s3Key = fmt.Sprintf("%s/karpenter-nodeclaims-%s.csv", strings.TrimSuffix(s3Prefix, "/"), startTimestamp)
+		s3Key = fmt.Sprintf("%s/karpenter-nodeclaims-%s.%s%s", strings.TrimSuffix(s3Prefix, "/"), startTimestamp, extension, suffix)
 	} else {
 		// Use current timestamp for timestamped mode (new key on each update)
 		timestamp := time.Now().Format(timeFormat)
-		s3Key = fmt.Sprintf("%s/karpenter-nodeclaims-%s.csv", strings.TrimSuffix(s3Prefix, "/"), timestamp)
+		s3Key = fmt.Sprintf("%s/karpenter-nodeclaims-%s.%s%s", strings.TrimSuffix(s3Prefix, "/"), timestamp, extension, suffix)
 	}
 	// Upload to S3
 	_, err = client.PutObject(uploadCtx, &s3.PutObjectInput{
 		Bucket:      aws.String(s3Bucket),
 		Key:         aws.String(s3Key),
-		Body:        bytes.NewReader([]byte(csvData)),
-		ContentType: aws.String("text/csv"),
+		Body:        bytes.NewReader(uploadData),
+		ContentType: aws.String(contentType),
 	})
 	// Check context state for better error messages
 	if err != nil {
@@ -159,3 +169,27 @@ func UploadToS3(nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
 	fmt.Fprintf(os.Stderr, "Successfully uploaded to s3://%s/%s\n", s3Bucket, s3Key)
 	return nil
 }
+
+// Sink uploads nodeclaims to S3 on every write
+type Sink struct{}
+
+func (Sink) Name() string {
+	return "s3"
+}
+
+func (Sink) Write(nodeclaimmap *map[string]lp4k.Nodeclaimstruct) error {
+	return UploadToS3(nodeclaimmap)
+}
+
+// NewSink returns the S3 sink or nil if S3 upload is disabled
+// the S3 sink is enabled by default if LP4K_S3_BUCKET is set
+func NewSink() lp4k.Sink {
+	if !lp4k.SinkEnabled("s3", s3Enabled) {
+		return nil
+	}
+	if !s3Enabled {
+		fmt.Fprintf(os.Stderr, "Warning: S3 sink requires environment variable %s - S3 sink disabled\n", s3BucketEnv)
+		return nil
+	}
+	return Sink{}
+}
@@ -6,48 +6,79 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/awslabs/LogParserForKarpenter/k8s"
 	lp4k "github.com/awslabs/LogParserForKarpenter/parser"
-	"k8s.io/client-go/util/homedir"
 )
 
 func main() {
 	//var logline, filename string
-	var cmname string
 	var nodeclaimmap *map[string]lp4k.Nodeclaimstruct
+	// helper map of k8snodename to nodeclaim, derived from K8snodename of all read nodeclaims
+	var k8snodenamemap *map[string]string
 
 	// intialize maps
 	nodeclaimes := make(map[string]lp4k.Nodeclaimstruct)
 	nodeclaimmap = &nodeclaimes
-	/*
-		k8snodenames := make(map[string]string)
-		k8snodenamemap = &k8snodenames
-	*/
+	k8snodenames := make(map[string]string)
+	k8snodenamemap = &k8snodenames
 
 	// parse the .kubeconfig file
-	var kubeconfig *string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
+	kubeconfig := flag.String("kubeconfig", "", "(optional) absolute path to the kubeconfig file, defaults to KUBECONFIG or ~/.kube/config")
+	kubecontext := flag.String("context", "", "(optional) name of the kubeconfig context to use instead of the current context")
+	cluster := flag.String("cluster", "", "(optional) name of the kubeconfig cluster to use instead of the cluster of the context")
+	watch := flag.Bool("watch", false, "watch a single ConfigMap and print its nodeclaims on every change until Ctrl-C")
+	diff := flag.Bool("diff", false, "print only changed fields of nodeclaims present in both of two ConfigMaps")
+	bynode := flag.Bool("by-node", false, "print nodeclaims keyed and sorted by K8s node name, omitting nodeclaims without node")
+	diffformat := flag.String("diff-format", "csv", "output format of -diff, \"csv\" or \"json\"")
 	flag.Parse()
 
-	ctx, clientSet := k8s.ConnectToK8s(kubeconfig)
+	if *diff && flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Flag -diff requires exactly two ConfigMap names\n")
+		os.Exit(1)
+	}
+	if *diffformat != "csv" && *diffformat != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid flag -diff-format \"%s\", must be \"csv\" or \"json\"\n", *diffformat)
+		os.Exit(1)
+	}
 
-	for _, arg := range os.Args[1:] {
-		cmname = arg
+	if *watch && flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Flag -watch requires exactly one ConfigMap name\n")
+		os.Exit(1)
+	}
 
-		fmt.Fprintf(os.Stderr, "\nParsing ConfigMap %s\n", cmname)
+	if *watch || *diff {
+		ctx, clientSet := k8s.ConnectToK8s(kubeconfig, *kubecontext, *cluster)
 
-		// main parsing logic
-		k8s.ReadnodeclaimsConfigMap(ctx, clientSet, cmname, nodeclaimmap)
+		if *watch {
+			k8s.WatchnodeclaimsConfigMap(ctx, clientSet, flag.Arg(0), lp4k.PrintSortedResult)
+			return
+		}
 
-		fmt.Fprintf(os.Stderr, "Finished parsing ConfigMap %s\n", cmname)
+		diffs, err := k8s.DiffnodeclaimsConfigMaps(ctx, clientSet, flag.Arg(0), flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+		lp4k.PrintDiff(diffs, *diffformat)
+		return
 	}
+
+	// main parsing logic, continues with the remaining ConfigMaps on failure
+	err := k8s.ReadnodeclaimsConfigMaps(kubeconfig, *kubecontext, *cluster, flag.Args(), nodeclaimmap)
+	// exit non-zero after printing the merged nodeclaims of all read ConfigMaps
+	defer func() {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\n%s\n", err.Error())
+			os.Exit(1)
+		}
+	}()
 	fmt.Fprintf(os.Stderr, "\n")
 	// print nodeclaim output to STDOUT
+	if *bynode {
+		lp4k.Populatek8snodenamemap(nodeclaimmap, k8snodenamemap)
+		lp4k.PrintNodeResult(nodeclaimmap, k8snodenamemap)
+		return
+	}
 	lp4k.PrintSortedResult(nodeclaimmap)
 }